@@ -0,0 +1,29 @@
+package client
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// nextBackoff returns the delay before the next poll after a failed one under
+// WithBackoff, and grows the delay for the failure after it. The caller must
+// hold mu.
+func (c *Client) nextBackoff() time.Duration {
+	delay := c.connectBackoff
+	if delay == 0 {
+		delay = c.backoffInitial
+	}
+	c.connectBackoff = min(time.Duration(float64(delay)*c.backoffFactor), c.backoffMax)
+	if c.backoffJitter > 0 {
+		delay -= time.Duration(rand.Float64() * c.backoffJitter * float64(delay))
+	}
+	return delay
+}
+
+// resetBackoff returns the WithBackoff delay to its initial value after a
+// successful poll.
+func (c *Client) resetBackoff() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connectBackoff = 0
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffGrows(t *testing.T) {
+	c := NewClient("http://unused.invalid", WithBackoff(10*time.Millisecond, 80*time.Millisecond, 2))
+
+	want := []time.Duration{10, 20, 40, 80, 80}
+	for i, w := range want {
+		if got := c.retryDelay(); got != w*time.Millisecond {
+			t.Errorf("Failure %d: expected a delay of %v, got %v", i+1, w*time.Millisecond, got)
+		}
+	}
+	c.resetBackoff()
+	if got := c.retryDelay(); got != 10*time.Millisecond {
+		t.Errorf("Expected the delay to restart at the initial value after a success, got %v", got)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	c := NewClient("http://unused.invalid", WithBackoff(100*time.Millisecond, 100*time.Millisecond, 2), WithBackoffJitter(0.5))
+	for i := 0; i < 20; i++ {
+		if got := c.retryDelay(); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("Expected a jittered delay between 50ms and 100ms, got %v", got)
+		}
+	}
+}
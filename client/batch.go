@@ -0,0 +1,338 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// Batch collects operations so they can be sent to the server together in a
+// single request by Commit.
+type Batch struct {
+	c            *Client
+	mu           sync.Mutex
+	unsubscribes []string
+	subscribes   []batchSubscribe
+	publishes    []message.BayeuxMessage
+}
+
+// batchSubscribe is a subscribe queued in a Batch.
+type batchSubscribe struct {
+	sub     *subscription
+	handler func(*message.BayeuxMessage)
+}
+
+// Batch starts a new, empty batch of operations for this client.
+func (c *Client) Batch() *Batch {
+	return &Batch{c: c}
+}
+
+// Unsubscribe queues the removal of every handler registered on channel.
+// Nothing happens until Commit.
+func (b *Batch) Unsubscribe(channel string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unsubscribes = append(b.unsubscribes, channel)
+}
+
+// Subscribe queues a subscribe to channel with handler. The handler is
+// registered by Commit before the request is sent, and the returned
+// Subscription is only active from then on, and only if the server accepts
+// the subscribe; a failed one removes it again. Subscribes are sent after the
+// batch's unsubscribes and before its publishes, so that a reply to a publish
+// of the same batch cannot overtake the subscribe meant to receive it.
+func (b *Batch) Subscribe(channel string, handler func(*message.BayeuxMessage)) (Subscription, error) {
+	if isMetaChannel(channel) {
+		return nil, fmt.Errorf("Error on the subscription request: %s is a reserved meta channel", channel)
+	}
+	b.c.handlersMu.Lock()
+	b.c.nextHandlerID++
+	sub := &subscription{c: b.c, channel: channel, id: b.c.nextHandlerID}
+	b.c.handlersMu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribes = append(b.subscribes, batchSubscribe{sub: sub, handler: handler})
+	return sub, nil
+}
+
+// Publish queues a publish of data to channel. Nothing is sent until Commit,
+// which treats it as PublishMany does.
+func (b *Batch) Publish(channel string, data map[string]interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.publishes = append(b.publishes, b.c.publishRequest(channel, data))
+}
+
+// Commit applies the queued operations in one request: the handlers of every
+// queued unsubscribe are removed locally and the server is told to drop those
+// subscriptions, the queued subscribes are registered and sent, then the
+// queued publishes. The returned error joins the per-operation failures. The
+// batch is empty afterwards and can be reused.
+func (b *Batch) Commit() error {
+	return b.CommitContext(context.Background())
+}
+
+// CommitContext is Commit bound to ctx.
+func (b *Batch) CommitContext(ctx context.Context) error {
+	_, err := b.commit(ctx)
+	return err
+}
+
+// commit is CommitContext, also returning the ids of the subscriptions the
+// server acknowledged.
+func (b *Batch) commit(ctx context.Context) (map[int]bool, error) {
+	b.mu.Lock()
+	channels, subscribes, publishes := b.unsubscribes, b.subscribes, b.publishes
+	b.unsubscribes, b.subscribes, b.publishes = nil, nil, nil
+	b.mu.Unlock()
+
+	if len(subscribes) == 0 && len(publishes) == 0 {
+		return nil, b.c.unsubscribeChannels(ctx, b.c.dropHandlers(channels))
+	}
+	return b.c.commitBatch(ctx, b.c.dropHandlers(channels), subscribes, publishes)
+}
+
+// SubscribeMany subscribes handler to every channel in channels with a single
+// request, one /meta/subscribe per channel. The channels the server accepted
+// keep the handler; it is removed from those that failed, whose errors are
+// joined in the returned one. The returned function removes the handler from
+// every channel at once, telling the server in a single request to drop the
+// channels left without handlers. Nothing is sent if a channel is a meta
+// channel.
+func (c *Client) SubscribeMany(channels []string, handler func(*message.BayeuxMessage)) (func(), error) {
+	b := c.Batch()
+	subs := make([]Subscription, 0, len(channels))
+	for _, channel := range channels {
+		sub, err := b.Subscribe(channel, handler)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	accepted, err := b.commit(context.Background())
+	var kept []Subscription
+	for _, sub := range subs {
+		if accepted[sub.ID()] {
+			kept = append(kept, sub)
+		}
+	}
+	return func() {
+		var last []string
+		for _, sub := range kept {
+			if c.removeHandler(sub.Channel(), sub.ID()) {
+				last = append(last, sub.Channel())
+			}
+		}
+		if err := c.unsubscribeChannels(context.Background(), last); err != nil {
+			c.reportError("/meta/unsubscribe", err)
+		}
+	}, err
+}
+
+// OutgoingMessage is one message of a PublishMany call.
+type OutgoingMessage struct {
+	Channel string
+	Data    map[string]interface{}
+}
+
+// PublishMany publishes messages, in order, with a single request. Like
+// Publish, it honors WithPublishRateLimit, with one turn per message,
+// WithPublishDedup and WithBufferPublishesDuringReconnect. The returned error
+// joins the failures of the individual messages, each naming its channel.
+// Unlike Publish, failed messages are not retried.
+func (c *Client) PublishMany(messages []OutgoingMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	b := c.Batch()
+	for _, m := range messages {
+		b.Publish(m.Channel, m.Data)
+	}
+	return b.Commit()
+}
+
+// commitBatch sends the unsubscribes from channels, the subscribes and the
+// publishes of a Batch as a single request, registering the subscribe
+// handlers first and removing those of the subscribes that failed. Under
+// WithAsyncSubscribeAck a subscribe the response does not acknowledge waits
+// for its ack on the connect channel, as Subscribe does. It returns the ids
+// of the subscriptions the server acknowledged.
+func (c *Client) commitBatch(ctx context.Context, channels []string, subscribes []batchSubscribe, publishes []message.BayeuxMessage) (accepted map[int]bool, err error) {
+	if err := c.ensureHandshake(ctx); err != nil {
+		return nil, err
+	}
+	if len(publishes) > 0 {
+		if err := c.awaitReconnect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	ctx, span := c.startSpan(ctx, "batch", "")
+	defer func() { span.End(err) }()
+
+	var errs []error
+	var reqMsgs []extMessage
+	for _, ch := range channels {
+		reqMsgs = append(reqMsgs, extMessage{BayeuxMessage: c.unsubscribeMessage(ch)})
+	}
+	var sent []batchSubscribe
+	defer func() {
+		// Without responses to match, no queued subscribe took effect.
+		if accepted == nil {
+			for _, s := range sent {
+				c.removeHandler(s.sub.channel, s.sub.id)
+			}
+		}
+	}()
+	var acks []chan *message.BayeuxMessage
+	for _, s := range subscribes {
+		if err := c.registerBatchHandler(s); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent = append(sent, s)
+		msg := c.subscribeMessage(s.sub.channel)
+		if c.asyncSubscribeAck {
+			msg.ID = c.newMessageID()
+			acks = append(acks, c.expectSubscribeAck(msg.ID))
+			defer c.forgetSubscribeAck(msg.ID)
+		}
+		reqMsgs = append(reqMsgs, extMessage{BayeuxMessage: msg})
+	}
+	var forgets []func()
+	defer func() {
+		// Without responses to match, no queued publish reached the server.
+		if accepted == nil {
+			for _, forget := range forgets {
+				forget()
+			}
+		}
+	}()
+	for _, msg := range publishes {
+		forget, err := c.checkDuplicate(msg.Channel, msg.Data, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Error publishing to %s: %w", msg.Channel, err))
+			continue
+		}
+		forgets = append(forgets, forget)
+		msg.ClientID = c.getClientID()
+		reqMsgs = append(reqMsgs, extMessage{BayeuxMessage: msg})
+	}
+	if len(reqMsgs) == 0 {
+		return map[int]bool{}, errors.Join(errs...)
+	}
+	if err := c.waitPublishTurns(ctx, len(forgets)); err != nil {
+		return nil, errors.Join(append(errs, err)...)
+	}
+	for i := range reqMsgs {
+		if reqMsgs[i].Channel == "/meta/subscribe" || reqMsgs[i].Channel == "/meta/unsubscribe" {
+			reqMsgs[i].ClientID = c.getClientID()
+		}
+		if err := c.prepareOutgoing(&reqMsgs[i].BayeuxMessage); err != nil {
+			return nil, errors.Join(append(errs, fmt.Errorf("Error on the batch request: %w", err))...)
+		}
+		reqMsgs[i].Ext = c.outgoingExt(nil)
+	}
+
+	reqBody, err := json.Marshal(reqMsgs)
+	if err != nil {
+		return nil, errors.Join(append(errs, fmt.Errorf("Error during request marshal: %w", err))...)
+	}
+	resp, err := c.post(ctx, reqBody)
+	if err != nil {
+		return nil, errors.Join(append(errs, fmt.Errorf("Error on the batch request: %w", err))...)
+	}
+	defer resp.Body.Close()
+
+	var respMsgs []message.BayeuxMessage
+	if err := c.decode(resp.Body, &respMsgs); err != nil {
+		return nil, errors.Join(append(errs, fmt.Errorf("Error decoding the message: %w", err))...)
+	}
+	c.noteAdvice(respMsgs)
+
+	accepted = make(map[int]bool)
+	used := make([]bool, len(respMsgs))
+	next, nextPublish := 0, 0
+	for i := range reqMsgs {
+		req := &reqMsgs[i].BayeuxMessage
+		ack := matchAck(req, respMsgs, used)
+		switch req.Channel {
+		case "/meta/unsubscribe":
+			if ack == nil {
+				errs = append(errs, fmt.Errorf("Error unsubscribing from %s: %w", req.Subscription, errEmptyResponse))
+			} else if !c.succeeded(ack) {
+				errs = append(errs, fmt.Errorf("Error unsubscribing from %s: %w", req.Subscription, newServerError(ack)))
+			}
+		case "/meta/subscribe":
+			s := sent[next]
+			next++
+			var subErr error
+			if ack == nil && c.asyncSubscribeAck {
+				ack, subErr = receiveSubscribeAck(ctx, acks[next-1])
+			} else if ack == nil {
+				subErr = errEmptyResponse
+			}
+			if ack != nil {
+				subErr = c.confirmSubscribe(req, ack)
+			}
+			if subErr != nil {
+				c.removeHandler(s.sub.channel, s.sub.id)
+				errs = append(errs, fmt.Errorf("Error subscribing to %s: %w", s.sub.channel, subErr))
+				continue
+			}
+			accepted[s.sub.id] = true
+			c.confirmSubscription(s.sub.channel)
+			c.store.Add(s.sub.channel)
+		default:
+			forget := forgets[nextPublish]
+			nextPublish++
+			if ack == nil {
+				forget()
+				errs = append(errs, fmt.Errorf("Error publishing to %s: %w", req.Channel, errEmptyResponse))
+			} else if !c.succeeded(ack) {
+				forget()
+				errs = append(errs, fmt.Errorf("Error publishing to %s: %w", req.Channel, newServerError(ack)))
+			} else {
+				c.updateStats(func(s *Stats) { s.Publishes++ })
+			}
+		}
+	}
+	return accepted, errors.Join(errs...)
+}
+
+// registerBatchHandler registers the handler of a subscribe queued in a
+// Batch, within the WithMaxSubscriptions and WithMaxHandlers limits.
+func (c *Client) registerBatchHandler(s batchSubscribe) error {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	channel := s.sub.channel
+	if err := c.checkSubscriptionLimits(channel); err != nil {
+		return err
+	}
+	c.handlers[channel] = append(c.handlers[channel], handlerEntry{id: s.sub.id, handler: s.handler})
+	c.trackPattern(channel)
+	c.trackWorker(channel)
+	return nil
+}
+
+// matchAck returns the first response not yet used that acknowledges req: on
+// the same channel, and for the same subscription and with the same id unless
+// the server left those out.
+func matchAck(req *message.BayeuxMessage, respMsgs []message.BayeuxMessage, used []bool) *message.BayeuxMessage {
+	for i := range respMsgs {
+		ack := &respMsgs[i]
+		if used[i] || ack.Channel != req.Channel {
+			continue
+		}
+		if (ack.Subscription != "" && ack.Subscription != req.Subscription) || (ack.ID != "" && ack.ID != req.ID) {
+			continue
+		}
+		used[i] = true
+		return ack
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestBatchUnsubscribe(t *testing.T) {
+	var batches [][]message.BayeuxMessage
+	server := newAckServer(&batches)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	for _, ch := range []string{"/foo", "/bar", "/baz"} {
+		if _, err := c.Subscribe(ch, func(msg *message.BayeuxMessage) {}); err != nil {
+			t.Fatalf("Subscribe to %s failed: %v", ch, err)
+		}
+	}
+
+	b := c.Batch()
+	b.Unsubscribe("/foo")
+	b.Unsubscribe("/bar")
+	b.Unsubscribe("/foo")
+	if len(batches) != 0 {
+		t.Fatalf("Expected nothing to be sent before Commit")
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("Expected a single request with 2 unsubscribes, got %v", batches)
+	}
+	c.handlersMu.RLock()
+	_, fooLeft := c.handlers["/foo"]
+	bazLeft := len(c.handlers["/baz"])
+	c.handlersMu.RUnlock()
+	if fooLeft {
+		t.Errorf("Expected /foo handlers to be removed")
+	}
+	if bazLeft != 1 {
+		t.Errorf("Expected /baz handler to be kept, got %d", bazLeft)
+	}
+
+	if err := b.Commit(); err != nil || len(batches) != 1 {
+		t.Errorf("Expected an empty Commit to send nothing, got err %v and %d batches", err, len(batches))
+	}
+}
+
+func TestBatchSubscribeAndPublish(t *testing.T) {
+	var mu sync.Mutex
+	var requests [][]message.BayeuxMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		mu.Lock()
+		requests = append(requests, reqMsgs)
+		mu.Unlock()
+		resp := make([]message.BayeuxMessage, 0, len(reqMsgs))
+		for _, req := range reqMsgs {
+			resp = append(resp, message.BayeuxMessage{Channel: req.Channel, ID: req.ID, Subscription: req.Subscription, Successful: boolPtr(true)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	b := c.Batch()
+	b.Publish("/service/echo", map[string]interface{}{"replyTo": "/reply/1"})
+	sub, err := b.Subscribe("/reply/1", func(msg *message.BayeuxMessage) {})
+	if err != nil {
+		t.Fatalf("Batch Subscribe failed: %v", err)
+	}
+	if sub.Active() {
+		t.Errorf("Expected the handler not to be registered before Commit")
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if len(requests) != 1 || len(requests[0]) != 2 {
+		t.Fatalf("Expected one request with a subscribe and a publish, got %v", requests)
+	}
+	if requests[0][0].Channel != "/meta/subscribe" || requests[0][0].Subscription != "/reply/1" || requests[0][1].Channel != "/service/echo" {
+		t.Errorf("Expected the subscribe to precede the publish, got %v", requests[0])
+	}
+	if !sub.Active() || !c.subscriptionConfirmed("/reply/1") {
+		t.Errorf("Expected the subscription to be registered and confirmed")
+	}
+	if got := c.Stats().Publishes; got != 1 {
+		t.Errorf("Expected the publish to be counted, got %d", got)
+	}
+	if _, err := b.Subscribe("/meta/connect", func(msg *message.BayeuxMessage) {}); err == nil {
+		t.Errorf("Expected a meta channel subscribe to be rejected")
+	}
+}
+
+func TestBatchSubscribeRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		resp := make([]message.BayeuxMessage, 0, len(reqMsgs))
+		for _, req := range reqMsgs {
+			ok := req.Subscription != "/reject"
+			resp = append(resp, message.BayeuxMessage{Channel: req.Channel, Subscription: req.Subscription, Successful: boolPtr(ok)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	b := c.Batch()
+	kept, _ := b.Subscribe("/keep", func(msg *message.BayeuxMessage) {})
+	rejected, _ := b.Subscribe("/reject", func(msg *message.BayeuxMessage) {})
+	if err := b.Commit(); err == nil {
+		t.Errorf("Expected the rejected subscribe to be reported")
+	}
+	if !kept.Active() || rejected.Active() {
+		t.Errorf("Expected only the accepted subscription to stay active, got /keep %v and /reject %v", kept.Active(), rejected.Active())
+	}
+
+	server.Close()
+	b.Subscribe("/unsent", func(msg *message.BayeuxMessage) {})
+	if err := b.Commit(); err == nil || c.hasHandlers("/unsent") {
+		t.Errorf("Expected a failed request to remove its subscribes' handlers, got %v", err)
+	}
+}
+
+func TestSubscribeMany(t *testing.T) {
+	var mu sync.Mutex
+	var requests [][]message.BayeuxMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		mu.Lock()
+		requests = append(requests, reqMsgs)
+		mu.Unlock()
+		resp := make([]message.BayeuxMessage, 0, len(reqMsgs))
+		for _, req := range reqMsgs {
+			ok := req.Subscription != "/denied"
+			resp = append(resp, message.BayeuxMessage{Channel: req.Channel, Subscription: req.Subscription, Successful: boolPtr(ok)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	// A confirmation left over from an earlier subscribe must not keep a
+	// channel this batch failed.
+	c.confirmSubscription("/denied")
+
+	unsubscribe, err := c.SubscribeMany([]string{"/a", "/denied", "/b"}, func(msg *message.BayeuxMessage) {})
+	if err == nil || !strings.Contains(err.Error(), "/denied") {
+		t.Errorf("Expected the /denied failure to be reported, got %v", err)
+	}
+	if len(requests) != 1 || len(requests[0]) != 3 {
+		t.Fatalf("Expected the three subscribes in one request, got %v", requests)
+	}
+	if !c.hasHandlers("/a") || !c.hasHandlers("/b") || c.hasHandlers("/denied") {
+		t.Errorf("Expected only the accepted channels to keep the handler")
+	}
+
+	unsubscribe()
+	if c.hasHandlers("/a") || c.hasHandlers("/b") {
+		t.Errorf("Expected the handler to be removed from every channel")
+	}
+	if len(requests) != 2 || len(requests[1]) != 2 || requests[1][0].Channel != "/meta/unsubscribe" {
+		t.Errorf("Expected both unsubscribes in one request, got %v", requests)
+	}
+}
+
+func TestPublishMany(t *testing.T) {
+	var requests [][]message.BayeuxMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		requests = append(requests, reqMsgs)
+		resp := make([]message.BayeuxMessage, 0, len(reqMsgs))
+		for _, req := range reqMsgs {
+			resp = append(resp, message.BayeuxMessage{Channel: req.Channel, ID: req.ID, Successful: boolPtr(req.Channel != "/rejected")})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	err := c.PublishMany([]OutgoingMessage{
+		{Channel: "/a", Data: map[string]interface{}{"n": 1}},
+		{Channel: "/rejected", Data: map[string]interface{}{"n": 2}},
+		{Channel: "/b", Data: map[string]interface{}{"n": 3}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "/rejected") || strings.Contains(err.Error(), "/a") {
+		t.Errorf("Expected only /rejected to be reported, got %v", err)
+	}
+	if len(requests) != 1 || len(requests[0]) != 3 {
+		t.Fatalf("Expected the three publishes in one request, got %v", requests)
+	}
+	for i, channel := range []string{"/a", "/rejected", "/b"} {
+		if requests[0][i].Channel != channel {
+			t.Errorf("Expected publish %d to go to %s, got %s", i, channel, requests[0][i].Channel)
+		}
+	}
+	if got := c.Stats().Publishes; got != 2 {
+		t.Errorf("Expected the two accepted publishes to be counted, got %d", got)
+	}
+}
+
+func TestPublishManyHonorsPublishOptions(t *testing.T) {
+	var mu sync.Mutex
+	var requests [][]message.BayeuxMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		mu.Lock()
+		requests = append(requests, reqMsgs)
+		mu.Unlock()
+		resp := make([]message.BayeuxMessage, 0, len(reqMsgs))
+		for _, req := range reqMsgs {
+			resp = append(resp, message.BayeuxMessage{Channel: req.Channel, ID: req.ID, Successful: boolPtr(req.Channel != "/rejected")})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithPublishRateLimit(20), WithPublishDedup(time.Minute), WithBufferPublishesDuringReconnect(1))
+	c.clientID = "test-client-id"
+	messages := []OutgoingMessage{
+		{Channel: "/a", Data: map[string]interface{}{"n": 1}},
+		{Channel: "/rejected", Data: map[string]interface{}{"n": 2}},
+		{Channel: "/b", Data: map[string]interface{}{"n": 3}},
+		{Channel: "/c", Data: map[string]interface{}{"n": 4}},
+		{Channel: "/d", Data: map[string]interface{}{"n": 5}},
+	}
+
+	start := time.Now()
+	c.PublishMany(messages)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected the rate limit to pace the five publishes, took %s", elapsed)
+	}
+
+	err := c.PublishMany(messages)
+	if !errors.Is(err, ErrDuplicateSuppressed) {
+		t.Errorf("Expected the repeated publishes to be suppressed, got %v", err)
+	}
+	mu.Lock()
+	if n := len(requests); n != 2 || len(requests[1]) != 1 || requests[1][0].Channel != "/rejected" {
+		t.Errorf("Expected only the rejected publish to be sent again, got %v", requests)
+	}
+	mu.Unlock()
+
+	c.beginReconnect()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.PublishMany([]OutgoingMessage{{Channel: "/e", Data: map[string]interface{}{"n": 6}}})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the publishes to be held during the reconnect, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.endReconnect()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the held publishes to be sent after the reconnect, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import "strings"
+
+// ChannelMatcher decides whether a message on channel is delivered to the
+// handlers registered on pattern. Set one with WithChannelMatcher for servers
+// whose channel patterns differ from Bayeux globs.
+type ChannelMatcher interface {
+	Matches(pattern, channel string) bool
+}
+
+// GlobMatcher implements the standard Bayeux wildcard semantics used by
+// default: a trailing "*" matches one segment and "**" any number of them.
+type GlobMatcher struct{}
+
+// Matches reports whether channel is matched by the wildcard pattern.
+func (GlobMatcher) Matches(pattern, channel string) bool {
+	return matchChannel(pattern, channel)
+}
+
+// isWildcard reports whether channel is a Bayeux wildcard pattern: a trailing
+// "*" matches one segment and a trailing "**" any number of segments.
+func isWildcard(channel string) bool {
+	return strings.HasSuffix(channel, "/*") || strings.HasSuffix(channel, "/**")
+}
+
+// matchChannel reports whether channel is matched by the wildcard pattern.
+func matchChannel(pattern, channel string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return strings.HasPrefix(channel, prefix+"/") && len(channel) > len(prefix)+1
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		rest, ok := strings.CutPrefix(channel, prefix+"/")
+		return ok && rest != "" && !strings.Contains(rest, "/")
+	}
+	return false
+}
+
+// matches reports whether pattern matches channel under the configured
+// ChannelMatcher.
+func (c *Client) matches(pattern, channel string) bool {
+	if c.matcher == nil {
+		return matchChannel(pattern, channel)
+	}
+	return c.matcher.Matches(pattern, channel)
+}
+
+// trackPattern records or forgets channel in the list of patterns that
+// dispatch matches against, depending on whether it still has handlers. With
+// the default matcher only Bayeux wildcards are tracked and exact channels are
+// looked up directly; a custom ChannelMatcher may treat any channel as a
+// pattern, so every one is tracked. The caller must hold handlersMu for
+// writing.
+func (c *Client) trackPattern(channel string) {
+	if c.matcher == nil && !isWildcard(channel) {
+		return
+	}
+	i := -1
+	for j, p := range c.patterns {
+		if p == channel {
+			i = j
+			break
+		}
+	}
+	switch {
+	case len(c.handlers[channel]) > 0 && i < 0:
+		c.patterns = append(c.patterns, channel)
+	case len(c.handlers[channel]) == 0 && i >= 0:
+		c.patterns = append(c.patterns[:i:i], c.patterns[i+1:]...)
+	}
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestMatchChannel(t *testing.T) {
+	tests := []struct {
+		pattern, channel string
+		want             bool
+	}{
+		{"/events/*", "/events/user", true},
+		{"/events/*", "/events/user/5", false},
+		{"/events/*", "/events", false},
+		{"/events/**", "/events/user", true},
+		{"/events/**", "/events/user/5", true},
+		{"/events/**", "/events", false},
+		{"/events/**", "/eventsx/user", false},
+		{"/events/user", "/events/user", false},
+	}
+	for _, tt := range tests {
+		if got := matchChannel(tt.pattern, tt.channel); got != tt.want {
+			t.Errorf("matchChannel(%q, %q) = %v, want %v", tt.pattern, tt.channel, got, tt.want)
+		}
+	}
+}
+
+func TestDispatchWildcard(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	received := make(chan string, 2)
+	exact, _ := c.Subscribe("/events/user/5", func(msg *message.BayeuxMessage) { received <- "exact" })
+	pattern, _ := c.Subscribe("/events/**", func(msg *message.BayeuxMessage) { received <- "pattern" })
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/events/user/5"})
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case name := <-received:
+			got[name] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Expected both exact and pattern handlers, got %v", got)
+		}
+	}
+
+	exact.Unsubscribe()
+	pattern.Unsubscribe()
+	if len(c.patterns) != 0 {
+		t.Errorf("Expected pattern to be forgotten after unsubscribe, got %v", c.patterns)
+	}
+	if len(c.handlers["/events/user/5"]) != 0 {
+		t.Errorf("Expected exact handlers to stay untouched by pattern dispatch")
+	}
+}
+
+func TestDispatchWildcardDepth(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	received := make(chan string, 4)
+	for _, pattern := range []string{"/foo/*", "/foo/**"} {
+		pattern := pattern
+		if _, err := c.Subscribe(pattern, func(msg *message.BayeuxMessage) { received <- pattern + " " + msg.Channel }); err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo/bar"})
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo/bar/baz"})
+	got := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case name := <-received:
+			got[name] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Expected three deliveries, got %v", got)
+		}
+	}
+	want := map[string]bool{"/foo/* /foo/bar": true, "/foo/** /foo/bar": true, "/foo/** /foo/bar/baz": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	select {
+	case name := <-received:
+		t.Errorf("Unexpected delivery %s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type regexpMatcher struct{}
+
+func (regexpMatcher) Matches(pattern, channel string) bool {
+	re, err := regexp.Compile("^" + pattern + "$")
+	return err == nil && re.MatchString(channel)
+}
+
+func TestWithChannelMatcher(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL, WithChannelMatcher(regexpMatcher{}))
+	c.clientID = "test-client-id"
+
+	received := make(chan string, 2)
+	c.Subscribe(`/orders/[0-9]+`, func(msg *message.BayeuxMessage) { received <- msg.Channel })
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/orders/abc"})
+	c.dispatch(&message.BayeuxMessage{Channel: "/orders/42"})
+	select {
+	case channel := <-received:
+		if channel != "/orders/42" {
+			t.Errorf("Expected only /orders/42 to match, got %s", channel)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the regexp pattern to match /orders/42")
+	}
+	select {
+	case channel := <-received:
+		t.Errorf("Unexpected delivery on %s", channel)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
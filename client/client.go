@@ -2,254 +2,1394 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/charlinchui/galliard/message"
+	"golang.org/x/time/rate"
 )
 
+// loopState is the lifecycle state of the connect loop.
+type loopState int
+
+const (
+	// loopIdle means no connect loop is running.
+	loopIdle loopState = iota
+	// loopRunning means a connect loop is polling the server.
+	loopRunning
+	// loopStopping means Disconnect signalled the loop, which has not exited yet.
+	loopStopping
+	// loopPolling means a PollOnce call is polling the server.
+	loopPolling
+)
+
+// connectTimeoutMargin is added to the server's advised timeout to size the
+// /meta/connect request deadline, leaving room for network delay.
+const connectTimeoutMargin = 10 * time.Second
+
+// supportedConnectionTypes lists the transports this client implements, in
+// order of preference.
+var supportedConnectionTypes = []string{"long-polling"}
+
+// handshakeRequest is a /meta/handshake message. It carries the fields the
+// message package does not model.
+type handshakeRequest struct {
+	message.BayeuxMessage
+	Version                  string                 `json:"version"`
+	SupportedConnectionTypes []string               `json:"supportedConnectionTypes"`
+	Ext                      map[string]interface{} `json:"ext,omitempty"`
+}
+
+// extMessage is a message carrying an ext object, which the message package
+// does not model.
+type extMessage struct {
+	message.BayeuxMessage
+	Ext map[string]interface{} `json:"ext,omitempty"`
+}
+
+// isMetaChannel reports whether channel is in the reserved /meta/ namespace.
+func isMetaChannel(channel string) bool {
+	return channel == "/meta" || strings.HasPrefix(channel, "/meta/")
+}
+
 type handlerEntry struct {
-	id      int
-	handler func(*message.BayeuxMessage)
+	id       int
+	handler  func(*message.BayeuxMessage)
+	metadata map[string]string
+	// direct handlers are called on the dispatching goroutine, so that they
+	// see a channel's messages in arrival order.
+	direct bool
+	// onRemove, if set, is called once the handler has been removed, however
+	// that happened.
+	onRemove func()
 }
 
 // Client implements a Bayeux protocol client for connecting to a Bayeux server.
 type Client struct {
 	serverURL     string
+	serverURLs    []string
+	fastestServer bool
+	serverIndex   int
+	httpClient    *http.Client
+	transport     *http.Transport
 	clientID      string
+	sessionEnded  bool
 	handlers      map[string][]handlerEntry
+	patterns      []string
+	matcher       ChannelMatcher
 	handlersMu    sync.RWMutex
 	mu            sync.Mutex
-	done          chan struct{}
-	running       bool
+	cancel        context.CancelFunc
+	stopped       chan struct{}
+	state         loopState
+	connState     ConnectionState
 	nextHandlerID int
+	nextMessageID int
+
+	// resubscribePending is set by a handshake that left channels with
+	// handlers unknown to the new session, until resubscribe runs.
+	resubscribePending bool
+
+	connectionTypes      []string
+	requestBuilder       func(ctx context.Context, url string, body []byte) (*http.Request, error)
+	httpTrace            bool
+	timestampField       string
+	onConnectionTiming   func(ConnectionTiming)
+	responseUnwrapper    func([]byte) ([]byte, error)
+	useNumber            bool
+	successInference     bool
+	subscribeConfirmer   func(request, response *message.BayeuxMessage) (bool, error)
+	asyncSubscribeAck    bool
+	dedupServerSubscribe bool
+	maxSubscriptions     int
+	maxHandlers          int
+	store                SubscriptionStore
+
+	autoHandshake bool
+	handshakeMu   sync.Mutex
+
+	ready          chan struct{}
+	readyOnce      sync.Once
+	lastMessageAt  time.Time
+	advisedTimeout time.Duration
+	advice         *message.Advice
+	connectTimeout time.Duration
+
+	minConnectInterval time.Duration
+	onKeepalive        func()
+
+	livenessInterval time.Duration
+	livenessWriter   io.Writer
+
+	errorHandler       func(error)
+	errorWriter        io.Writer
+	errorLog           *errorLogLimiter
+	stopOnConnectError bool
+	restartOnLoopPanic bool
+	// errorWriterMu serializes the lines written to the error writer, which
+	// handler goroutines and the connect loop report to concurrently.
+	errorWriterMu sync.Mutex
+
+	failoverThreshold      int
+	maxRehandshakes        int
+	handshakeExtFunc       func() map[string]interface{}
+	backoffInitial         time.Duration
+	backoffMax             time.Duration
+	backoffFactor          float64
+	backoffJitter          float64
+	connectBackoff         time.Duration
+	onClientIDChange       func(oldID, newID string)
+	connectFailures        int
+	resubscribeGrace       time.Duration
+	autoResubscribe        bool
+	onOrphanedSubscription func(channel string, err error)
+
+	publishRetries int
+	publishBackoff time.Duration
+	publishLimiter *rate.Limiter
+	publishBuffer  int
+	dedupWindow    time.Duration
+	dedupSeen      map[[sha256.Size]byte]time.Time
+	dedupMu        sync.Mutex
+	dedupSwept     time.Time
+	heldPublishes  int
+	reconnecting   chan struct{}
+	requestSlots   chan struct{}
+
+	retryClassifier  RetryClassifier
+	tracer           Tracer
+	orderedHandlers  bool
+	channelQueues    map[string]*channelQueue
+	perChannelWorker bool
+	workers          map[string]*channelWorker
+	handlerTimeout   time.Duration
+	onSlowHandler    func(channel string, elapsed time.Duration)
+	onUnhandled      func(msg *message.BayeuxMessage)
+	stateListener    func(old, new ConnectionState)
+	strictDecode     bool
+
+	running      int
+	handlersIdle chan struct{}
+	runningMu    sync.Mutex
+
+	sequenceFields map[string]string
+	lastSequence   map[string]int64
+	sequenceMu     sync.Mutex
+	onSequenceGap  func(channel string, expected, got int64)
+
+	onOutgoing func(*message.BayeuxMessage)
+	onIncoming func(*message.BayeuxMessage)
+
+	extensions            []Extension
+	extensionErrorHandler func(ext Extension, failure interface{})
+	abortOnExtensionError bool
+
+	startupBufferSize int
+	startupBuffer     []*message.BayeuxMessage
+	startupReleased   bool
+	startupTimer      *time.Timer
+	startupMu         sync.Mutex
+
+	idGenerator      func() string
+	correlationField string
+	calls            map[string]pendingCall
+	subscribeAcks    map[string]chan *message.BayeuxMessage
+	confirmations    map[string]chan struct{}
+	confirmMu        sync.Mutex
+	callsMu          sync.Mutex
+
+	batchers   map[*messageBatcher]struct{}
+	batchersMu sync.Mutex
+
+	stats   Stats
+	statsMu sync.Mutex
+
+	opts   []Option
+	optErr error
 }
 
 // NewClient creates a new Bayeux client for the given server URL.
-func NewClient(serverURL string) *Client {
-	return &Client{
-		serverURL: serverURL,
-		handlers:  make(map[string][]handlerEntry),
-		done:      make(chan struct{}),
+func NewClient(serverURL string, opts ...Option) *Client {
+	c := &Client{
+		serverURL:         serverURL,
+		failoverThreshold: defaultFailoverThreshold,
+		maxRehandshakes:   defaultMaxRehandshakes,
+		autoResubscribe:   true,
+		handlers:          make(map[string][]handlerEntry),
+		ready:             make(chan struct{}),
+		connectionTypes:   supportedConnectionTypes,
+		store:             NewMemorySubscriptionStore(),
+		correlationField:  "id",
+		calls:             make(map[string]pendingCall),
+		subscribeAcks:     make(map[string]chan *message.BayeuxMessage),
+		confirmations:     make(map[string]chan struct{}),
+		sequenceFields:    make(map[string]string),
+		lastSequence:      make(map[string]int64),
+		opts:              opts,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	switch {
+	case c.httpClient != nil && c.transport != nil:
+		c.optErr = errors.Join(c.optErr, errors.New("WithHTTPClient cannot be combined with transport options"))
+	case c.httpClient != nil:
+	case c.transport != nil:
+		c.httpClient = &http.Client{Transport: c.transport}
+	default:
+		c.httpClient = http.DefaultClient
+	}
+	return c
+}
+
+// ownTransport returns the client's private transport, cloning
+// http.DefaultTransport the first time an option needs to configure it.
+func (c *Client) ownTransport() *http.Transport {
+	if c.transport == nil {
+		c.transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	return c.transport
+}
+
+// post sends a Bayeux request body to the server, bound to ctx. Under
+// WithMaxConcurrentRequests it first waits for a free slot, which is held
+// until the response body is closed.
+func (c *Client) post(ctx context.Context, body []byte) (*http.Response, error) {
+	return c.postTo(ctx, c.ServerURL(), body)
+}
+
+// postTo is post against url rather than the current server.
+func (c *Client) postTo(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	if c.requestSlots == nil {
+		return c.doRequest(ctx, url, body)
+	}
+	select {
+	case c.requestSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("Error waiting for a request slot: %w", ctx.Err())
+	}
+	resp, err := c.doRequest(ctx, url, body)
+	if err != nil {
+		<-c.requestSlots
+		return nil, err
+	}
+	resp.Body = &slotBody{ReadCloser: resp.Body, release: func() { <-c.requestSlots }}
+	return resp, nil
+}
+
+// slotBody releases a request slot when the response body is closed.
+type slotBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// defaultRequestBuilder builds the standard JSON POST of a Bayeux batch.
+func defaultRequestBuilder(ctx context.Context, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// postDirect sends a request without taking a request slot. The connect long
+// poll uses it so that it never queues behind, or blocks, other requests.
+func (c *Client) postDirect(ctx context.Context, body []byte) (*http.Response, error) {
+	return c.doRequest(ctx, c.ServerURL(), body)
+}
+
+// doRequest posts body to url through the client's HTTP client. Every
+// Bayeux request, whatever its path, ends up here, so that the client set by
+// WithHTTPClient is honored throughout.
+func (c *Client) doRequest(ctx context.Context, url string, body []byte) (*http.Response, error) {
+	if c.optErr != nil {
+		return nil, fmt.Errorf("invalid client option: %w", c.optErr)
+	}
+	build := c.requestBuilder
+	if build == nil {
+		build = defaultRequestBuilder
+	}
+	var tracer *connectionTracer
+	if c.httpTrace {
+		ctx, tracer = traceConnection(ctx)
+	}
+	req, err := build(ctx, url, body)
+	if err != nil {
+		return nil, err
+	}
+	injectSpan(ctx, req.Header)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if tracer != nil && c.onConnectionTiming != nil {
+		c.onConnectionTiming(tracer.done())
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Response: resp}
+	}
+	return resp, nil
+}
+
+// decode reads a response batch from body into respMsgs, passing the raw
+// body through the WithResponseUnwrapper hook first when one is set. A body
+// cut off mid-stream is reported as an IncompleteResponseError. Under
+// WithStrictDecode a message with an unknown field fails the whole batch.
+func (c *Client) decode(body io.Reader, respMsgs *[]message.BayeuxMessage) error {
+	var raw []byte
+	if c.responseUnwrapper != nil || c.strictDecode {
+		var err error
+		if raw, err = io.ReadAll(body); err != nil {
+			return incomplete(err)
+		}
+		if c.responseUnwrapper != nil {
+			if raw, err = c.responseUnwrapper(raw); err != nil {
+				return fmt.Errorf("Error unwrapping the response: %w", err)
+			}
+		}
+		body = bytes.NewReader(raw)
+	}
+	dec := json.NewDecoder(body)
+	if c.useNumber {
+		dec.UseNumber()
+	}
+	if err := dec.Decode(respMsgs); err != nil {
+		return incomplete(err)
+	}
+	if c.strictDecode {
+		if err := checkUnknownFields(raw); err != nil {
+			return err
+		}
+	}
+	for i := range *respMsgs {
+		c.applyIncoming(&(*respMsgs)[i])
+		if c.onIncoming != nil {
+			c.onIncoming(&(*respMsgs)[i])
+		}
+	}
+	return nil
+}
+
+// succeeded reports whether an acknowledgement reports success. A missing
+// successful field counts as failure unless WithSuccessInference is set and
+// the ack carries no error either.
+func (c *Client) succeeded(ack *message.BayeuxMessage) bool {
+	if ack.Successful == nil {
+		return c.successInference && ack.Error == ""
+	}
+	return *ack.Successful
+}
+
+// observeOutgoing passes every message of a request batch to the OnOutgoing
+// hook just before the batch is encoded.
+func (c *Client) observeOutgoing(msgs ...*message.BayeuxMessage) {
+	if c.onOutgoing == nil {
+		return
+	}
+	for _, msg := range msgs {
+		c.onOutgoing(msg)
 	}
 }
 
 // Handshake performs the Bayeux handshake and stores the clientID.
 func (c *Client) Handshake() error {
-	reqMsg := message.BayeuxMessage{
-		Channel: "/meta/handshake",
+	return c.HandshakeContext(context.Background())
+}
+
+// HandshakeContext is Handshake bound to ctx: cancelling it aborts the
+// request in flight.
+func (c *Client) HandshakeContext(ctx context.Context) error {
+	return c.handshake(ctx)
+}
+
+func (c *Client) handshake(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "handshake", "/meta/handshake")
+	defer func() { span.End(err) }()
+
+	c.changeState(Handshaking, Disconnected)
+	defer func() {
+		if err != nil {
+			c.changeState(Disconnected, Handshaking)
+		} else {
+			c.changeState(Connected, Handshaking)
+		}
+	}()
+
+	reqMsg := c.handshakeMessage()
+	var ext map[string]interface{}
+	if c.handshakeExtFunc != nil {
+		ext = c.handshakeExtFunc()
 	}
 
-	reqBody, err := json.Marshal([]message.BayeuxMessage{reqMsg})
+	if err := c.prepareOutgoing(&reqMsg.BayeuxMessage); err != nil {
+		return fmt.Errorf("Error on the handshake request: %w", err)
+	}
+	reqMsg.Ext = c.outgoingExt(ext)
+	reqBody, err := json.Marshal([]handshakeRequest{reqMsg})
 	if err != nil {
 		return fmt.Errorf("Error on the handshake Marshal: %w", err)
 	}
 
-	resp, err := http.Post(c.serverURL, "application/json", bytes.NewReader(reqBody))
+	if c.fastestServer && len(c.serverURLs) > 1 && c.getClientID() == "" {
+		return c.raceHandshakes(ctx, reqBody)
+	}
+	ack, err := c.handshakeAt(ctx, c.ServerURL(), reqBody)
+	if err != nil {
+		return err
+	}
+	c.acceptHandshake(ack)
+	return nil
+}
+
+// handshakeAt sends the handshake reqBody to url and returns the server's
+// successful acknowledgement.
+func (c *Client) handshakeAt(ctx context.Context, url string, reqBody []byte) (*message.BayeuxMessage, error) {
+	resp, err := c.postTo(ctx, url, reqBody)
 	if err != nil {
-		return fmt.Errorf("Error on the Handshake call: %w", err)
+		return nil, fmt.Errorf("Error on the Handshake call: %w", err)
 	}
 
 	defer resp.Body.Close()
 
+	var raw bytes.Buffer
 	var respMsgs []message.BayeuxMessage
-	if err := json.NewDecoder(resp.Body).Decode(&respMsgs); err != nil {
-		return fmt.Errorf("Error decoding handshake response: %w", err)
+	if err := c.decode(io.TeeReader(resp.Body, &raw), &respMsgs); err != nil {
+		return nil, fmt.Errorf("Error decoding handshake response: %w", err)
+	}
+
+	if len(respMsgs) > 0 && respMsgs[0].Successful != nil && !*respMsgs[0].Successful {
+		if err := c.versionMismatch(raw.Bytes(), &respMsgs[0]); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Error on the handshake: %w", newServerError(&respMsgs[0]))
 	}
 
 	if len(respMsgs) == 0 || respMsgs[0].ClientID == "" {
-		return fmt.Errorf("Error on the hanshake: no clientId in response")
+		return nil, fmt.Errorf("Error on the hanshake: no clientId in response")
 	}
+	return &respMsgs[0], nil
+}
+
+// acceptHandshake starts the session described by a successful handshake
+// acknowledgement.
+func (c *Client) acceptHandshake(ack *message.BayeuxMessage) {
+	orphans := len(c.activeChannels()) > 0
+	c.mu.Lock()
+	c.clientID = ack.ClientID
+	c.sessionEnded = false
+	c.resubscribePending = c.resubscribePending || orphans
+	c.updateStats(func(s *Stats) { s.Handshakes++ })
+	if ack.Advice != nil {
+		c.advice = ack.Advice
+	}
+	if advice := ack.Advice; advice != nil && advice.Timeout > 0 {
+		c.advisedTimeout = time.Duration(advice.Timeout) * time.Millisecond
+	}
+	c.mu.Unlock()
+	c.resetConfirmations()
+}
 
-	c.clientID = respMsgs[0].ClientID
+// rehandshake replaces the session with a fresh handshake, resubscribes the
+// channels that still have handlers and reports the new client id to
+// OnClientIDChange. Resubscribe failures go to the error handler.
+func (c *Client) rehandshake(ctx context.Context) error {
+	oldID := c.getClientID()
+	if err := c.handshake(ctx); err != nil {
+		return err
+	}
+	if err := c.resubscribe(ctx); err != nil {
+		c.reportError("/meta/subscribe", err)
+	}
+	if c.onClientIDChange != nil {
+		c.onClientIDChange(oldID, c.getClientID())
+	}
 	return nil
 }
 
+// endSession forgets the client id once a disconnect has been attempted, as
+// the server may already have dropped the session, and marks it for
+// renewSession.
+func (c *Client) endSession() {
+	c.mu.Lock()
+	c.clientID = ""
+	c.sessionEnded = true
+	c.mu.Unlock()
+	c.resetConfirmations()
+	c.changeState(Disconnected)
+}
+
+// getClientID returns the session id assigned by the last handshake.
+func (c *Client) getClientID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clientID
+}
+
+// ensureHandshake performs the handshake on behalf of Subscribe and Publish
+// when WithAutoHandshake is enabled and no session exists yet. handshakeMu
+// makes concurrent callers wait for a single handshake.
+func (c *Client) ensureHandshake(ctx context.Context) error {
+	if !c.autoHandshake {
+		return nil
+	}
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+	if c.getClientID() != "" {
+		return nil
+	}
+	return c.handshake(ctx)
+}
+
 // Subscribe subscribes to a channel and registers a callback for messages.
-// Returns an unsubscribe function that removes the handler.
-func (c *Client) Subscribe(channel string, handler func(*message.BayeuxMessage)) (func(), error) {
+// Returns a Subscription whose Unsubscribe removes the handler. Meta channels
+// are reserved for the client's own protocol handling and cannot be
+// subscribed to.
+func (c *Client) Subscribe(channel string, handler func(*message.BayeuxMessage)) (Subscription, error) {
+	return c.SubscribeContext(context.Background(), channel, handler)
+}
+
+// SubscribeContext is Subscribe bound to ctx: cancelling it aborts the
+// subscribe request in flight.
+func (c *Client) SubscribeContext(ctx context.Context, channel string, handler func(*message.BayeuxMessage)) (Subscription, error) {
+	return c.subscribe(ctx, channel, nil, func(_ Subscription, msg *message.BayeuxMessage) {
+		handler(msg)
+	})
+}
+
+// SubscribeWithMetadata is like Subscribe, but tags the subscription with
+// metadata, such as the feature it serves. The metadata is available from
+// the returned Subscription's Metadata and is appended as key=value pairs to
+// the lines WithErrorWriter writes for the handler's panics.
+func (c *Client) SubscribeWithMetadata(channel string, metadata map[string]string, handler func(*message.BayeuxMessage)) (Subscription, error) {
+	return c.subscribe(context.Background(), channel, metadata, func(_ Subscription, msg *message.BayeuxMessage) {
+		handler(msg)
+	})
+}
+
+// SubscribeEx is like Subscribe, but the handler also receives the
+// Subscription it was registered with, so it can tell the subscribed channel
+// (sub.Channel()) apart from the one the message arrived on (msg.Channel).
+func (c *Client) SubscribeEx(channel string, handler func(sub Subscription, msg *message.BayeuxMessage)) (Subscription, error) {
+	return c.subscribe(context.Background(), channel, nil, handler)
+}
+
+// SubscribeUntil is like Subscribe, but handler can end the subscription
+// by returning ErrStopSubscription, possibly wrapped: its handler is removed
+// and, if it was the channel's last, the server is told to unsubscribe. Any
+// other error goes to WithErrorHandler and WithErrorWriter. Messages already
+// being dispatched may still reach handler after it asked to stop.
+func (c *Client) SubscribeUntil(channel string, handler func(*message.BayeuxMessage) error) (Subscription, error) {
+	return c.SubscribeEx(channel, func(sub Subscription, msg *message.BayeuxMessage) {
+		err := handler(msg)
+		switch {
+		case errors.Is(err, ErrStopSubscription):
+			if err := sub.Unsubscribe(); err != nil {
+				c.reportError("/meta/unsubscribe", err)
+			}
+		case err != nil:
+			c.reportError(msg.Channel, err)
+		}
+	})
+}
+
+// SubscribeFunc is like Subscribe but returns a bare unsubscribe function.
+//
+// Deprecated: use Subscribe and call Unsubscribe on the returned Subscription.
+func (c *Client) SubscribeFunc(channel string, handler func(*message.BayeuxMessage)) (func(), error) {
+	sub, err := c.Subscribe(channel, handler)
+	if err != nil {
+		return nil, err
+	}
+	return func() { sub.Unsubscribe() }, nil
+}
+
+func (c *Client) subscribe(ctx context.Context, channel string, metadata map[string]string, handler func(Subscription, *message.BayeuxMessage)) (Subscription, error) {
+	return c.subscribeEntry(ctx, channel, metadata, handlerEntry{}, handler)
+}
+
+// subscribeEntry registers handler on channel, with the direct and onRemove
+// settings of template, and subscribes the session to channel.
+func (c *Client) subscribeEntry(ctx context.Context, channel string, metadata map[string]string, template handlerEntry, handler func(Subscription, *message.BayeuxMessage)) (Subscription, error) {
+	if isMetaChannel(channel) {
+		return nil, fmt.Errorf("Error on the subscription request: %s is a reserved meta channel", channel)
+	}
+	if err := c.ensureHandshake(ctx); err != nil {
+		return nil, err
+	}
+
 	c.handlersMu.Lock()
+	if err := c.checkSubscriptionLimits(channel); err != nil {
+		c.handlersMu.Unlock()
+		return nil, err
+	}
 	c.nextHandlerID++
-	entry := handlerEntry{id: c.nextHandlerID, handler: handler}
+	sub := &subscription{c: c, channel: channel, id: c.nextHandlerID, metadata: copyMetadata(metadata)}
+	entry := template
+	entry.id, entry.metadata = sub.id, sub.metadata
+	entry.handler = func(msg *message.BayeuxMessage) { handler(sub, msg) }
 	c.handlers[channel] = append(c.handlers[channel], entry)
+	c.trackPattern(channel)
+	c.trackWorker(channel)
 	c.handlersMu.Unlock()
 
-	reqMsg := message.BayeuxMessage{
-		Channel:      "/meta/subscribe",
-		ClientID:     c.clientID,
-		Subscription: channel,
+	if !c.dedupServerSubscribe || !c.subscriptionConfirmed(channel) {
+		if err := c.sendSubscribe(ctx, channel); err != nil {
+			c.removeHandler(channel, sub.id)
+			return nil, err
+		}
 	}
+	c.store.Add(channel)
 
-	reqBody, err := json.Marshal([]message.BayeuxMessage{reqMsg})
+	return sub, nil
+}
+
+// sendSubscribe asks the server to subscribe the session to channel.
+func (c *Client) sendSubscribe(ctx context.Context, channel string) (err error) {
+	ctx, span := c.startSpan(ctx, "subscribe", channel)
+	defer func() { span.End(err) }()
+
+	reqMsg := c.subscribeMessage(channel)
+	var ack chan *message.BayeuxMessage
+	if c.asyncSubscribeAck {
+		reqMsg.ID = c.newMessageID()
+		ack = c.expectSubscribeAck(reqMsg.ID)
+		defer c.forgetSubscribeAck(reqMsg.ID)
+	}
+
+	if err := c.prepareOutgoing(&reqMsg); err != nil {
+		return fmt.Errorf("Error on the subscription request: %w", err)
+	}
+	reqBody, err := json.Marshal([]extMessage{{BayeuxMessage: reqMsg, Ext: c.outgoingExt(nil)}})
 	if err != nil {
-		return nil, fmt.Errorf("Error during request marshal: %w", err)
+		return fmt.Errorf("Error during request marshal: %w", err)
 	}
 
-	resp, err := http.Post(c.serverURL, "application/json", bytes.NewReader(reqBody))
+	resp, err := c.post(ctx, reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("Error on the subscription request: %w", err)
+		return fmt.Errorf("Error on the subscription request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var respMsgs []message.BayeuxMessage
-	if err := json.NewDecoder(resp.Body).Decode(&respMsgs); err != nil {
-		return nil, fmt.Errorf("Error decoding the message: %w", err)
+	if err := c.decode(resp.Body, &respMsgs); err != nil {
+		return fmt.Errorf("Error decoding the message: %w", err)
+	}
+	c.noteAdvice(respMsgs)
+
+	if c.asyncSubscribeAck {
+		if err := c.awaitSubscribeAck(ctx, &reqMsg, ack, respMsgs); err != nil {
+			return err
+		}
+	} else if len(respMsgs) == 0 {
+		return fmt.Errorf("Error on the subscription request: %w", errEmptyResponse)
+	} else if err := c.confirmSubscribe(&reqMsg, &respMsgs[0]); err != nil {
+		return fmt.Errorf("Error on the subscription request: %w", err)
+	}
+	c.confirmSubscription(channel)
+	return nil
+}
+
+// Publish sends a new message to a channel.
+func (c *Client) Publish(channel string, data map[string]interface{}) error {
+	return c.PublishContext(context.Background(), channel, data)
+}
+
+// PublishContext is Publish bound to ctx: cancelling it aborts the request
+// in flight and any wait for a retry, a reconnect or the rate limit.
+func (c *Client) PublishContext(ctx context.Context, channel string, data map[string]interface{}) error {
+	return c.publish(ctx, channel, data)
+}
+
+func (c *Client) publish(ctx context.Context, channel string, data map[string]interface{}) error {
+	return c.publishExt(ctx, channel, data, nil)
+}
+
+// publishExt publishes data to channel with ext as the message's ext object.
+func (c *Client) publishExt(ctx context.Context, channel string, data, ext map[string]interface{}) error {
+	forget, err := c.checkDuplicate(channel, data, ext)
+	if err != nil {
+		return err
+	}
+	if err := c.publishRetrying(ctx, message.BayeuxMessage{Channel: channel, Data: data}, ext, nil); err != nil {
+		forget()
+		return err
+	}
+	return nil
+}
+
+// waitPublishTurns waits until WithPublishRateLimit admits n publishes.
+func (c *Client) waitPublishTurns(ctx context.Context, n int) error {
+	if c.publishLimiter == nil {
+		return nil
 	}
+	for i := 0; i < n; i++ {
+		if err := c.publishLimiter.Wait(ctx); err != nil {
+			return fmt.Errorf("Error waiting for the publish rate limit: %w", err)
+		}
+	}
+	return nil
+}
 
-	if len(respMsgs) == 0 || respMsgs[0].Successful == nil || !*respMsgs[0].Successful {
-		return nil, fmt.Errorf("Error on the subscription request: %+v", respMsgs)
+// publishRetrying publishes reqMsg, with raw as its data when non-nil, once
+// there is a session, retrying failures under WithPublishRetries.
+func (c *Client) publishRetrying(ctx context.Context, reqMsg message.BayeuxMessage, ext map[string]interface{}, raw json.RawMessage) error {
+	if err := c.ensureHandshake(ctx); err != nil {
+		return err
 	}
+	if err := c.awaitReconnect(ctx); err != nil {
+		return err
+	}
+	reqMsg.ClientID = c.getClientID()
 
-	unsubscribe := func() {
-		c.handlersMu.Lock()
-		defer c.handlersMu.Unlock()
-		handlers := c.handlers[channel]
-		newHandlers := handlers[:0]
-		for _, h := range handlers {
-			if h.id != entry.id {
-				newHandlers = append(newHandlers, h)
+	backoff := c.publishBackoff
+	for retry := 0; ; retry++ {
+		_, err := c.publishMessage(ctx, reqMsg, ext, raw)
+		if err == nil || retry >= c.publishRetries {
+			return err
+		}
+		switch c.classify(err, defaultPublishClassifier) {
+		case Stop:
+			return err
+		case Rehandshake:
+			if err := c.rehandshake(ctx); err != nil {
+				return err
 			}
+			reqMsg.ClientID = c.getClientID()
+			continue
 		}
-		c.handlers[channel] = newHandlers
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
 	}
-	return unsubscribe, nil
 }
 
-// Publish sends a new message to a channel.
-func (c *Client) Publish(channel string, data map[string]interface{}) error {
-	reqMsg := message.BayeuxMessage{
-		Channel:  channel,
-		ClientID: c.clientID,
-		Data:     data,
+// publishMessage sends reqMsg, with ext as its ext object and raw in place of
+// its data when non-nil, and returns the full response batch. With
+// WithPublishRateLimit it first waits for the limiter, giving up when ctx is
+// done.
+func (c *Client) publishMessage(ctx context.Context, reqMsg message.BayeuxMessage, ext map[string]interface{}, raw json.RawMessage) (_ []message.BayeuxMessage, err error) {
+	ctx, span := c.startSpan(ctx, "publish", reqMsg.Channel)
+	defer func() { span.End(err) }()
+
+	if err := c.waitPublishTurns(ctx, 1); err != nil {
+		return nil, err
 	}
 
-	reqBody, err := json.Marshal([]message.BayeuxMessage{reqMsg})
+	if err := c.prepareOutgoing(&reqMsg); err != nil {
+		return nil, fmt.Errorf("Error on the publish request: %w", err)
+	}
+	var reqBody []byte
+	if raw != nil {
+		reqBody, err = marshalRaw([]rawDataMessage{{extMessage: extMessage{BayeuxMessage: reqMsg, Ext: c.outgoingExt(ext)}, Data: raw}})
+	} else {
+		reqBody, err = json.Marshal([]extMessage{{BayeuxMessage: reqMsg, Ext: c.outgoingExt(ext)}})
+	}
 	if err != nil {
-		return fmt.Errorf("Error on during request marshal: %w", err)
+		return nil, fmt.Errorf("Error on during request marshal: %w", err)
 	}
 
-	resp, err := http.Post(c.serverURL, "application/json", bytes.NewReader(reqBody))
+	resp, err := c.post(ctx, reqBody)
 	if err != nil {
-		return fmt.Errorf("Error on the publish request: %w", err)
+		return nil, fmt.Errorf("Error on the publish request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var respMsgs []message.BayeuxMessage
-	if err := json.NewDecoder(resp.Body).Decode(&respMsgs); err != nil {
-		return fmt.Errorf("Error decoding the message: %w", err)
+	if err := c.decode(resp.Body, &respMsgs); err != nil {
+		return nil, fmt.Errorf("Error decoding the message: %w", err)
 	}
+	c.noteAdvice(respMsgs)
 
-	if len(respMsgs) == 0 || respMsgs[0].Successful == nil || !*respMsgs[0].Successful {
-		return fmt.Errorf("Error on the publish request: %+v", respMsgs)
+	if len(respMsgs) == 0 || !c.succeeded(&respMsgs[0]) {
+		return nil, fmt.Errorf("Error on the publish request: %w", responseError(respMsgs))
 	}
+	c.updateStats(func(s *Stats) { s.Publishes++ })
 
-	return nil
+	return respMsgs, nil
 }
 
 // Connect starts the long-polling loop to receive messages.
+// If a previous loop is still stopping after Disconnect, Connect waits for it
+// to exit first, so at most one loop ever runs. It fails while a PollOnce
+// call is polling.
 func (c *Client) Connect() error {
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext is Connect with the loop bound to ctx: cancelling it stops
+// the loop and aborts the long poll in flight at once, as Disconnect does,
+// but without sending /meta/disconnect.
+func (c *Client) ConnectContext(ctx context.Context) error {
+	if err := c.renewSession(ctx); err != nil {
+		return err
+	}
+	loopCtx, stopped, err := c.startLoop(ctx)
+	if err != nil {
+		return err
+	}
+
+	go c.loop(loopCtx, stopped)
+
+	return nil
+}
+
+// renewSession starts a fresh session when Disconnect ended the previous one,
+// so that a Connect after Disconnect never polls with a dead client id, and
+// resubscribes the channels that still have handlers whenever a handshake,
+// its own or an explicit one, left them unknown to the session.
+func (c *Client) renewSession(ctx context.Context) error {
 	c.mu.Lock()
-	if c.running {
-		c.mu.Unlock()
+	ended := c.sessionEnded
+	c.mu.Unlock()
+	if ended {
+		if err := c.handshake(ctx); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	pending := c.resubscribePending
+	c.mu.Unlock()
+	if !pending {
+		return nil
+	}
+	return c.resubscribe(ctx)
+}
+
+// Ready returns a channel that is closed the first time a connect cycle
+// succeeds. It is a one-shot signal: once closed it stays closed for the
+// lifetime of the client, including across Disconnect and later reconnects,
+// so it says the client has been connected at least once, not that it is
+// connected now.
+func (c *Client) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// ServeContext runs the long-polling loop on the calling goroutine until ctx
+// is done, Disconnect is called, or the loop stops on an error (see
+// WithStopOnConnectError). It returns ctx's error, nil after Disconnect, or
+// the error that stopped the loop.
+func (c *Client) ServeContext(ctx context.Context) error {
+	if err := c.renewSession(ctx); err != nil {
+		return err
+	}
+	loopCtx, stopped, err := c.startLoop(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = c.loop(loopCtx, stopped)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// PollOnce performs a single /meta/connect cycle on the calling goroutine,
+// dispatching the messages it returns, for callers that drive the polling
+// cadence themselves instead of running Connect. It fails while a connect
+// loop or another PollOnce is running, since both would poll the same
+// session, and Connect fails while it runs.
+func (c *Client) PollOnce(ctx context.Context) error {
+	c.mu.Lock()
+	state := c.state
+	if state == loopIdle {
+		c.state = loopPolling
+	}
+	c.mu.Unlock()
+	switch state {
+	case loopIdle:
+	case loopPolling:
+		return fmt.Errorf("Error: PollOnce already running")
+	default:
 		return fmt.Errorf("Error: Connect loop already running")
 	}
-	c.running = true
+	defer func() {
+		c.mu.Lock()
+		c.state = loopIdle
+		c.mu.Unlock()
+	}()
+	return c.connectOnce(ctx)
+}
+
+// startLoop moves the client to loopRunning and returns the new loop's
+// context, derived from parent and cancelled by stopLoop, and the channel
+// closed once the loop has exited.
+func (c *Client) startLoop(parent context.Context) (context.Context, chan struct{}, error) {
+	c.mu.Lock()
+	for c.state == loopStopping {
+		stopped := c.stopped
+		c.mu.Unlock()
+		<-stopped
+		c.mu.Lock()
+	}
+	switch c.state {
+	case loopRunning:
+		c.mu.Unlock()
+		return nil, nil, fmt.Errorf("Error: Connect loop already running")
+	case loopPolling:
+		c.mu.Unlock()
+		return nil, nil, fmt.Errorf("Error: PollOnce already running")
+	}
+	ctx, cancel := context.WithCancel(parent)
+	stopped := make(chan struct{})
+	c.cancel = cancel
+	c.stopped = stopped
+	c.state = loopRunning
 	c.mu.Unlock()
 
-	go func() {
-		for {
-			select {
-			case <-c.done:
-				return
-			default:
-				err := c.connectOnce()
-				if err != nil {
-					time.Sleep(1 * time.Second)
-				}
-			}
+	if c.livenessInterval > 0 {
+		go c.liveness(stopped)
+	}
+	return ctx, stopped, nil
+}
+
+// stopLoop cancels the running loop's context, if a loop is running. The
+// in-flight poll is aborted with it.
+func (c *Client) stopLoop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == loopRunning {
+		c.state = loopStopping
+		c.cancel()
+	}
+}
+
+// loop polls the server until ctx is cancelled and returns the error that
+// ended it. Each loop gets a fresh context and stopped channel from
+// startLoop, so a later Connect never shares them with an older loop. After
+// a successful poll it waits out the advised interval before the next one.
+// A failed poll is reported to the error handler and classified to decide
+// whether to retry, rehandshake or stop; with WithStopOnConnectError the
+// first failure ends the loop. A retry waits out the advised interval, one
+// second by default. A rehandshake runs at once and resubscribes the
+// registered channels; a failed one waits out the interval too, and
+// WithMaxRehandshakes failed ones in a row end the loop. Under
+// WithServerURLs, repeated failures move the loop to the next server, where
+// it handshakes and resubscribes. A panic on the loop goroutine is recovered
+// and ends the loop, unless WithRestartOnLoopPanic is set.
+func (c *Client) loop(ctx context.Context, stopped chan struct{}) error {
+	defer func() {
+		c.mu.Lock()
+		if c.stopped == stopped {
+			c.state = loopIdle
+			c.cancel()
+			c.cancel = nil
 		}
+		close(stopped)
+		c.mu.Unlock()
+		c.endReconnect()
+		c.changeState(Disconnected)
 	}()
 
+	failedHandshakes := 0
+	for ctx.Err() == nil {
+		err := c.guardLoop(func() error { return c.poll(ctx) })
+		if err == nil {
+			c.resetConnectFailures()
+			c.changeState(Connected)
+			if wait := c.pollInterval(); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(wait):
+				}
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		c.reportError("/meta/connect", err)
+		c.changeState(Reconnecting)
+		if c.stopOnConnectError || (isLoopPanic(err) && !c.restartOnLoopPanic) {
+			return err
+		}
+		decision := c.classify(err, defaultConnectClassifier)
+		if decision == Stop {
+			return err
+		}
+		if failover := c.countConnectFailure(); failover || decision == Rehandshake {
+			c.beginReconnect()
+			hsErr := c.guardLoop(func() error { return c.rehandshake(ctx) })
+			if hsErr == nil {
+				failedHandshakes = 0
+				c.endReconnect()
+				continue
+			}
+			c.reportError("/meta/handshake", hsErr)
+			if isLoopPanic(hsErr) && !c.restartOnLoopPanic {
+				return hsErr
+			}
+			failedHandshakes++
+			if !failover && c.maxRehandshakes > 0 && failedHandshakes >= c.maxRehandshakes {
+				return fmt.Errorf("Error: giving up after %d failed handshakes: %w", failedHandshakes, hsErr)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.retryDelay()):
+		}
+	}
 	return nil
 }
 
-func (c *Client) connectOnce() error {
-	reqMsg := message.BayeuxMessage{
-		Channel:  "/meta/connect",
-		ClientID: c.clientID,
+// pollInterval returns how long the loop waits after a successful poll
+// before the next one: the interval the server last advised, raised to
+// WithMinConnectInterval, so a server answering polls at once cannot make the
+// loop spin.
+func (c *Client) pollInterval() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wait := c.minConnectInterval
+	if c.advice != nil {
+		wait = max(wait, time.Duration(c.advice.Interval)*time.Millisecond)
+	}
+	return wait
+}
+
+// defaultRetryDelay is how long the loop waits after a failed poll when the
+// server has not advised an interval.
+const defaultRetryDelay = time.Second
+
+// retryDelay returns how long the loop waits after a failed poll: the
+// interval the server last advised, on the failed response itself or earlier,
+// or defaultRetryDelay without one. Under WithBackoff the growing backoff
+// delay is used instead, but never below the advised interval.
+func (c *Client) retryDelay() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.backoffInitial > 0 {
+		delay := c.nextBackoff()
+		if c.advice != nil {
+			delay = max(delay, time.Duration(c.advice.Interval)*time.Millisecond)
+		}
+		return max(c.minConnectInterval, delay)
+	}
+	if c.advice != nil && c.advice.Interval > 0 {
+		return max(c.minConnectInterval, time.Duration(c.advice.Interval)*time.Millisecond)
+	}
+	return max(c.minConnectInterval, defaultRetryDelay)
+}
+
+// connectRequestTimeout returns the deadline for a single /meta/connect
+// request. An explicit WithConnectTimeout wins; otherwise the timeout the
+// server advised at handshake is used plus connectTimeoutMargin; with neither
+// the request has no deadline of its own.
+func (c *Client) connectRequestTimeout() time.Duration {
+	if c.connectTimeout > 0 {
+		return c.connectTimeout
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.advisedTimeout > 0 {
+		return c.advisedTimeout + connectTimeoutMargin
+	}
+	return 0
+}
+
+// connectOnce performs a single /meta/connect cycle.
+func (c *Client) connectOnce(ctx context.Context) error {
+	return c.poll(ctx)
+}
+
+// poll performs a single /meta/connect cycle.
+func (c *Client) poll(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "connect", "/meta/connect")
+	defer func() { span.End(err) }()
+	defer c.updateStats(func(s *Stats) {
+		if err != nil {
+			s.ConnectErrors++
+		} else {
+			s.ConnectCycles++
+		}
+	})
+	defer func() {
+		if err == nil {
+			c.resetBackoff()
+		}
+	}()
+
+	if timeout := c.connectRequestTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	reqBody, err := json.Marshal([]message.BayeuxMessage{reqMsg})
+	reqMsg := c.connectMessage()
+
+	if err := c.prepareOutgoing(&reqMsg); err != nil {
+		return err
+	}
+	reqBody, err := json.Marshal([]extMessage{{BayeuxMessage: reqMsg, Ext: c.outgoingExt(nil)}})
 	if err != nil {
 		return err
 	}
 
-	resp, err := http.Post(c.serverURL, "application/json", bytes.NewReader(reqBody))
+	resp, err := c.postDirect(ctx, reqBody)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	var respMsgs []message.BayeuxMessage
-	if err := json.NewDecoder(resp.Body).Decode(&respMsgs); err != nil {
+	if err := c.decode(resp.Body, &respMsgs); err != nil {
 		return err
 	}
 
+	c.mu.Lock()
+	c.lastMessageAt = time.Now()
+	c.mu.Unlock()
+
+	var metaErr error
 	for _, msg := range respMsgs {
-		c.handlersMu.RLock()
-		handlers := c.handlers[msg.Channel]
-		c.handlersMu.RUnlock()
-		for _, entry := range handlers {
-			go func(h func(*message.BayeuxMessage), msg *message.BayeuxMessage) {
-				defer func() {
-					if r := recover(); r != nil {
-						fmt.Printf("%+v", r)
-					}
-				}()
-				h(msg)
-			}(entry.handler, &msg)
+		if isMetaChannel(msg.Channel) {
+			if err := c.handleMeta(&msg); err != nil {
+				metaErr = err
+			}
+			continue
+		}
+		if c.deliverReply(&msg) || c.bufferStartup(&msg) {
+			continue
 		}
+		c.dispatch(&msg)
+	}
+	if metaErr != nil {
+		return metaErr
 	}
 
+	c.readyOnce.Do(func() { close(c.ready) })
+	if len(respMsgs) == 0 && c.onKeepalive != nil {
+		c.onKeepalive()
+	}
 	return nil
 }
 
-// Disconnect gracefully disconnects from the server and stops the connect loop.
-func (c *Client) Disconnect() error {
-	c.mu.Lock()
-	if c.running {
-		close(c.done)
-		c.running = false
-		c.done = make(chan struct{})
+// handleMeta applies a control message received on the connect channel to
+// the client's own state. Meta messages are never passed to user handlers.
+func (c *Client) handleMeta(msg *message.BayeuxMessage) error {
+	if msg.Channel == "/meta/subscribe" {
+		c.deliverSubscribeAck(msg)
+		return nil
 	}
-	c.mu.Unlock()
+	if msg.Channel != "/meta/connect" {
+		return nil
+	}
+	if msg.Advice != nil {
+		c.mu.Lock()
+		c.advice = msg.Advice
+		c.mu.Unlock()
+	}
+	if msg.Successful != nil && !*msg.Successful {
+		return fmt.Errorf("Error on the connect request: %w", newServerError(msg))
+	}
+	return nil
+}
+
+// noteAdvice keeps the last advice found in a subscribe or publish response,
+// as handleMeta does for the connect channel, so that its interval applies to
+// the next polls. A reconnect:"handshake" advice on a failure is surfaced by
+// the response's ServerError, which then matches ErrSessionExpired.
+func (c *Client) noteAdvice(respMsgs []message.BayeuxMessage) {
+	for i := range respMsgs {
+		if respMsgs[i].Advice != nil {
+			c.mu.Lock()
+			c.advice = respMsgs[i].Advice
+			c.mu.Unlock()
+		}
+	}
+}
+
+// dispatch hands a data message to the handlers registered on its channel,
+// exact ones first, then those of the wildcard patterns matching it. A
+// message no handler matches, such as one still in flight when its channel
+// was unsubscribed, goes to the OnUnhandledMessage hook. Otherwise the first
+// delivery that applies takes every handler, those of Messages included:
+// the channel's WithChannelQueue, then under WithPerChannelWorker the worker
+// of each registered channel or pattern. Failing both, the handlers of
+// Messages are called on the calling goroutine, and the others each on its
+// own goroutine, or with WithOrderedHandlers all in registration order on a
+// single goroutine. When several handlers match, each gets its own copy of
+// the message, so changes to its Data stay private.
+func (c *Client) dispatch(msg *message.BayeuxMessage) {
+	c.countMessage(msg.Channel)
+	c.checkSequence(msg)
+
+	c.handlersMu.RLock()
+	handlers := c.handlers[msg.Channel]
+	for _, pattern := range c.patterns {
+		if pattern != msg.Channel && c.matches(pattern, msg.Channel) {
+			handlers = append(handlers[:len(handlers):len(handlers)], c.handlers[pattern]...)
+		}
+	}
+	c.handlersMu.RUnlock()
+
+	if len(handlers) == 0 {
+		if c.onUnhandled != nil {
+			go c.invoke(handlerEntry{handler: c.onUnhandled}, msg)
+		}
+		return
+	}
+	if c.enqueue(msg, handlers) {
+		return
+	}
+	if c.perChannelWorker {
+		c.dispatchToWorkers(msg, len(handlers))
+		return
+	}
+	if handlers = c.invokeDirect(msg, handlers); len(handlers) == 0 {
+		return
+	}
+	if c.orderedHandlers {
+		go func() {
+			for _, entry := range handlers {
+				c.invokeWithin(entry, handlerCopy(msg, len(handlers)))
+			}
+		}()
+		return
+	}
+	for _, entry := range handlers {
+		go c.invoke(entry, handlerCopy(msg, len(handlers)))
+	}
+}
+
+// invokeDirect calls the direct handlers among handlers on the calling
+// goroutine and returns the others. Channel queues and workers already keep
+// arrival order, so only the goroutine-per-message paths need it.
+func (c *Client) invokeDirect(msg *message.BayeuxMessage, handlers []handlerEntry) []handlerEntry {
+	if !slices.ContainsFunc(handlers, func(h handlerEntry) bool { return h.direct }) {
+		return handlers
+	}
+	rest := make([]handlerEntry, 0, len(handlers))
+	for _, entry := range handlers {
+		if entry.direct {
+			c.invoke(entry, handlerCopy(msg, len(handlers)))
+		} else {
+			rest = append(rest, entry)
+		}
+	}
+	return rest
+}
+
+// handlerCopy returns the message to hand to one of n handlers: msg itself
+// when it has a single handler, otherwise a private copy per handler.
+func handlerCopy(msg *message.BayeuxMessage, n int) *message.BayeuxMessage {
+	if n == 1 {
+		return msg
+	}
+	return cloneMessage(msg)
+}
 
-	reqMsg := message.BayeuxMessage{
-		Channel:  "/meta/disconnect",
-		ClientID: c.clientID,
+// invoke runs a single handler, recovering from a panic in it. Under
+// WithHandlerTimeout a watchdog reports the handler to OnSlowHandler once it
+// has run for longer than the timeout.
+func (c *Client) invoke(entry handlerEntry, msg *message.BayeuxMessage) {
+	c.beginHandler()
+	defer c.endHandler()
+	defer func() {
+		if r := recover(); r != nil {
+			c.reportPanic(msg.Channel, entry.metadata, r)
+		}
+	}()
+	if c.handlerTimeout > 0 && c.onSlowHandler != nil {
+		start := time.Now()
+		watchdog := time.AfterFunc(c.handlerTimeout, func() {
+			c.onSlowHandler(msg.Channel, time.Since(start))
+		})
+		defer watchdog.Stop()
 	}
+	entry.handler(msg)
+}
+
+// invokeWithin runs a handler for serial dispatch. Under WithHandlerTimeout
+// it stops waiting once the timeout expires, leaving the handler running on
+// its own so the handlers after it are not held up.
+func (c *Client) invokeWithin(entry handlerEntry, msg *message.BayeuxMessage) {
+	if c.handlerTimeout <= 0 {
+		c.invoke(entry, msg)
+		return
+	}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		c.invoke(entry, msg)
+	}()
+	timer := time.NewTimer(c.handlerTimeout)
+	defer timer.Stop()
+	select {
+	case <-finished:
+	case <-timer.C:
+	}
+}
 
-	reqBody, err := json.Marshal([]message.BayeuxMessage{reqMsg})
+// Disconnect gracefully disconnects from the server and stops the connect loop.
+// It ends the session, so a later Connect handshakes again and resubscribes
+// the channels that still have handlers. Buffered sinks implementing Flusher
+// are flushed last. It never waits for a running handler, so a handler may
+// call it.
+func (c *Client) Disconnect() error {
+	return c.DisconnectContext(context.Background())
+}
+
+// DisconnectContext is Disconnect with the /meta/disconnect request bound to
+// ctx. The connect loop is stopped whether or not ctx is done.
+func (c *Client) DisconnectContext(ctx context.Context) error {
+	c.stopLoop()
+	c.flushBatches()
+
+	err := c.disconnect(ctx)
+	return errors.Join(err, c.flushSinks())
+}
+
+func (c *Client) disconnect(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "disconnect", "/meta/disconnect")
+	defer func() { span.End(err) }()
+
+	reqMsg := c.disconnectMessage()
+	defer c.endSession()
+
+	if err := c.prepareOutgoing(&reqMsg); err != nil {
+		return fmt.Errorf("Error on the disconnect request: %w", err)
+	}
+	reqBody, err := json.Marshal([]extMessage{{BayeuxMessage: reqMsg, Ext: c.outgoingExt(nil)}})
 	if err != nil {
 		return fmt.Errorf("Error disconnecting: %w", err)
 	}
 
-	resp, err := http.Post(c.serverURL, "application/json", bytes.NewReader(reqBody))
+	resp, err := c.post(ctx, reqBody)
 	if err != nil {
 		return fmt.Errorf("Error on the disconnect request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var respMsgs []message.BayeuxMessage
-	if err := json.NewDecoder(resp.Body).Decode(&respMsgs); err != nil {
+	if err := c.decode(resp.Body, &respMsgs); err != nil {
 		return fmt.Errorf("Error decoding disconnect response: %w", err)
 	}
 
-	if len(respMsgs) == 0 || respMsgs[0].Successful == nil || !*respMsgs[0].Successful {
-		return fmt.Errorf("Error disconnecting from channel %+v", respMsgs)
+	if len(respMsgs) == 0 || !c.succeeded(&respMsgs[0]) {
+		return fmt.Errorf("Error disconnecting from channel: %w", responseError(respMsgs))
 	}
 
 	return nil
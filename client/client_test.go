@@ -1,9 +1,16 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -21,8 +28,8 @@ func TestNewClient(t *testing.T) {
 	if c.handlers == nil {
 		t.Errorf("Expected handlers map to be initialized")
 	}
-	if c.done == nil {
-		t.Errorf("Expected done channel to be initialized")
+	if c.state != loopIdle || c.cancel != nil {
+		t.Errorf("Expected no connect loop before Connect")
 	}
 }
 
@@ -79,8 +86,8 @@ func TestSubscribe(t *testing.T) {
 		var reqMsgs []message.BayeuxMessage
 		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
 
-		if len(reqMsgs) == 0 || reqMsgs[0].Channel != "/meta/subscribe" {
-			t.Errorf("Expected subscribe request, got %+v", reqMsgs)
+		if len(reqMsgs) == 0 || (reqMsgs[0].Channel != "/meta/subscribe" && reqMsgs[0].Channel != "/meta/unsubscribe") {
+			t.Errorf("Expected subscribe or unsubscribe request, got %+v", reqMsgs)
 		}
 
 		if reqMsgs[0].Subscription != "/foo" {
@@ -88,7 +95,7 @@ func TestSubscribe(t *testing.T) {
 		}
 
 		resp := []message.BayeuxMessage{{
-			Channel:      "/meta/subscribe",
+			Channel:      reqMsgs[0].Channel,
 			Successful:   boolPtr(true),
 			Subscription: "/foo",
 		}}
@@ -121,7 +128,7 @@ func TestSubscribe(t *testing.T) {
 		t.Errorf("Expected handler to be called")
 	}
 
-	unsubscribe()
+	unsubscribe.Unsubscribe()
 
 	c.handlersMu.RLock()
 	handlers, exists = c.handlers["/foo"]
@@ -158,6 +165,32 @@ func TestSubscribeError(t *testing.T) {
 	}
 }
 
+func TestSubscribeMetaChannel(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	for _, ch := range []string{"/meta/connect", "/meta/subscribe", "/meta"} {
+		if _, err := c.Subscribe(ch, func(msg *message.BayeuxMessage) {}); err == nil {
+			t.Errorf("Expected Subscribe on %s to fail", ch)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request to reach the server, got %d", requests)
+	}
+	c.handlersMu.RLock()
+	count := len(c.handlers)
+	c.handlersMu.RUnlock()
+	if count != 0 {
+		t.Errorf("Expected no handlers to be registered, got %d", count)
+	}
+}
+
 func TestMultipleSubscriptions(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var reqMsgs []message.BayeuxMessage
@@ -207,7 +240,7 @@ func TestMultipleSubscriptions(t *testing.T) {
 	}
 
 	called1, called2 = false, false
-	unsub1()
+	unsub1.Unsubscribe()
 
 	c.handlersMu.RLock()
 	handlers, exists = c.handlers["/foo"]
@@ -253,9 +286,9 @@ func TestUnsubscribeTwice(t *testing.T) {
 		t.Fatalf("Subscribe failed: %v", err)
 	}
 
-	unsubscribe()
+	unsubscribe.Unsubscribe()
 
-	unsubscribe()
+	unsubscribe.Unsubscribe()
 
 	c.handlersMu.RLock()
 	handlers, exists := c.handlers["/foo"]
@@ -388,9 +421,9 @@ func TestDisconnect(t *testing.T) {
 	c := NewClient(server.URL)
 	c.clientID = "test-client-id"
 
-	c.mu.Lock()
-	c.running = true
-	c.mu.Unlock()
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
 
 	err := c.Disconnect()
 	if err != nil {
@@ -402,7 +435,7 @@ func TestDisconnect(t *testing.T) {
 	}
 
 	c.mu.Lock()
-	if c.running {
+	if c.state == loopRunning {
 		t.Errorf("Client should not be running after disconnect")
 	}
 	c.mu.Unlock()
@@ -468,7 +501,7 @@ func TestConcurrentUnsubscribe(t *testing.T) {
 	c := NewClient(server.URL)
 	c.clientID = "test-client-id"
 
-	var unsubscribes []func()
+	var unsubscribes []Subscription
 	for i := 0; i < 10; i++ {
 		unsub, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
 		if err != nil {
@@ -481,9 +514,9 @@ func TestConcurrentUnsubscribe(t *testing.T) {
 	wg.Add(len(unsubscribes))
 
 	for i, unsub := range unsubscribes {
-		go func(i int, unsub func()) {
+		go func(i int, unsub Subscription) {
 			defer wg.Done()
-			unsub()
+			unsub.Unsubscribe()
 		}(i, unsub)
 	}
 
@@ -502,7 +535,10 @@ func TestMessageDispatch(t *testing.T) {
 	messageCount := 0
 	var mu sync.Mutex
 
-	c := NewClient("http://example.com/bayeux")
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
 	c.clientID = "test-client-id"
 
 	c.Subscribe("/foo", func(msg *message.BayeuxMessage) {
@@ -537,3 +573,1089 @@ func TestMessageDispatch(t *testing.T) {
 		t.Errorf("Expected 4 handler invocations, got %d", messageCount)
 	}
 }
+
+func TestConnectAfterDisconnect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		resp := []message.BayeuxMessage{{
+			Channel:    reqMsgs[0].Channel,
+			ClientID:   "test-client-id",
+			Successful: boolPtr(true),
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := c.Connect(); err == nil {
+		t.Errorf("Expected second Connect to fail while running")
+	}
+	if err := c.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect after Disconnect failed: %v", err)
+	}
+	c.Disconnect()
+}
+
+func TestConnectAfterDisconnectHandshakes(t *testing.T) {
+	var mu sync.Mutex
+	handshakes := 0
+	var connectIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		resp := message.BayeuxMessage{Channel: reqMsgs[0].Channel, Successful: boolPtr(true)}
+		switch reqMsgs[0].Channel {
+		case "/meta/handshake":
+			handshakes++
+			resp.ClientID = fmt.Sprintf("session-%d", handshakes)
+		case "/meta/connect":
+			connectIDs = append(connectIDs, reqMsgs[0].ClientID)
+		}
+		mu.Unlock()
+		if reqMsgs[0].Channel == "/meta/connect" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{resp})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+	if id := c.getClientID(); id != "" {
+		t.Errorf("Expected Disconnect to clear the client id, got %q", id)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect after Disconnect failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.Disconnect()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handshakes != 2 {
+		t.Errorf("Expected a fresh handshake before reconnecting, got %d handshakes", handshakes)
+	}
+	if n := len(connectIDs); n == 0 || connectIDs[n-1] != "session-2" {
+		t.Errorf("Expected the new session to be polled, got %v", connectIDs)
+	}
+}
+
+func TestConnectAfterExplicitHandshakeResubscribes(t *testing.T) {
+	var mu sync.Mutex
+	handshakes := 0
+	var subscribes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		req := reqMsgs[0]
+		resp := message.BayeuxMessage{Channel: req.Channel, Subscription: req.Subscription, Successful: boolPtr(true)}
+		switch req.Channel {
+		case "/meta/handshake":
+			handshakes++
+			resp.ClientID = fmt.Sprintf("session-%d", handshakes)
+		case "/meta/subscribe":
+			subscribes = append(subscribes, req.ClientID+" "+req.Subscription)
+		}
+		mu.Unlock()
+		if req.Channel == "/meta/connect" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{resp})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if _, err := c.Subscribe("/a", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			if err := c.Handshake(); err != nil {
+				t.Fatalf("Handshake after Disconnect failed: %v", err)
+			}
+		}
+		if err := c.Connect(); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if err := c.Disconnect(); err != nil {
+			t.Fatalf("Disconnect failed: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"session-1 /a", "session-2 /a"}; !reflect.DeepEqual(subscribes, want) {
+		t.Errorf("Expected /a subscribed once on each session, got %v", subscribes)
+	}
+}
+
+func TestConcurrentConnectDisconnect(t *testing.T) {
+	var mu sync.Mutex
+	connects := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		if reqMsgs[0].Channel == "/meta/connect" {
+			mu.Lock()
+			connects++
+			mu.Unlock()
+		}
+		resp := []message.BayeuxMessage{{
+			Channel:    reqMsgs[0].Channel,
+			Successful: boolPtr(true),
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				c.Connect()
+				c.Disconnect()
+			}
+		}()
+	}
+	wg.Wait()
+	c.Disconnect()
+
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Connect loop did not stop")
+	}
+
+	c.mu.Lock()
+	if c.state != loopIdle {
+		t.Errorf("Expected loop to be idle, got state %d", c.state)
+	}
+	c.mu.Unlock()
+
+	mu.Lock()
+	before := connects
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	after := connects
+	mu.Unlock()
+	if after != before {
+		t.Errorf("Expected no connect requests after the loop stopped, got %d more", after-before)
+	}
+}
+
+func TestAutoHandshake(t *testing.T) {
+	var mu sync.Mutex
+	handshakes := 0
+	var publishedBy []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		defer mu.Unlock()
+		resp := []message.BayeuxMessage{{Channel: reqMsgs[0].Channel, Successful: boolPtr(true)}}
+		switch reqMsgs[0].Channel {
+		case "/meta/handshake":
+			handshakes++
+			resp[0].ClientID = "auto-client-id"
+		default:
+			publishedBy = append(publishedBy, reqMsgs[0].ClientID)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithAutoHandshake(true))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := c.Publish("/foo", map[string]interface{}{"n": i}); err != nil {
+				t.Errorf("Publish %d failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handshakes != 1 {
+		t.Errorf("Expected exactly 1 handshake, got %d", handshakes)
+	}
+	for _, id := range publishedBy {
+		if id != "auto-client-id" {
+			t.Errorf("Expected publish with clientID 'auto-client-id', got %q", id)
+		}
+	}
+}
+
+func TestNoAutoHandshakeByDefault(t *testing.T) {
+	handshakes := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		if reqMsgs[0].Channel == "/meta/handshake" {
+			handshakes++
+		}
+		resp := []message.BayeuxMessage{{Channel: reqMsgs[0].Channel, Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	if err := c.Publish("/foo", map[string]interface{}{"msg": "hello"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if handshakes != 0 {
+		t.Errorf("Expected no implicit handshake, got %d", handshakes)
+	}
+}
+
+func TestPublishRetry(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		resp := []message.BayeuxMessage{{Channel: "/foo", Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithPublishRetry(3, time.Millisecond))
+	c.clientID = "test-client-id"
+
+	if err := c.Publish("/foo", map[string]interface{}{"msg": "hello"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+}
+
+func TestPublishRetryNotOnRejection(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		resp := []message.BayeuxMessage{{
+			Channel:    "/foo",
+			Successful: boolPtr(false),
+			Error:      "403::Publish denied",
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithPublishRetry(3, time.Millisecond))
+	c.clientID = "test-client-id"
+
+	err := c.Publish("/foo", map[string]interface{}{"msg": "hello"})
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Code != 403 {
+		t.Fatalf("Expected a 403 ServerError, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected a rejection not to be retried, got %d requests", requests)
+	}
+}
+
+func TestHandshakeSupportedConnectionTypes(t *testing.T) {
+	var advertised []interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		advertised, _ = reqMsgs[0]["supportedConnectionTypes"].([]interface{})
+		resp := []message.BayeuxMessage{{
+			Channel:    "/meta/handshake",
+			ClientID:   "test-client-id",
+			Successful: boolPtr(true),
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if len(advertised) != 1 || advertised[0] != "long-polling" {
+		t.Errorf("Expected supportedConnectionTypes [long-polling], got %v", advertised)
+	}
+
+	c = NewClient(server.URL, WithAdvertisedConnectionTypes([]string{"callback-polling"}))
+	if err := c.Handshake(); err == nil {
+		t.Errorf("Expected handshake to reject an unimplemented connection type")
+	}
+}
+
+func TestStopOnConnectError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var handled []error
+	c := NewClient(server.URL,
+		WithStopOnConnectError(true),
+		WithErrorHandler(func(err error) { handled = append(handled, err) }),
+	)
+	c.clientID = "test-client-id"
+
+	err := c.ServeContext(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected ServeContext to return the 500 error, got %v", err)
+	}
+	if len(handled) != 1 {
+		t.Errorf("Expected the error handler to fire once, got %d", len(handled))
+	}
+
+	c.mu.Lock()
+	if c.state != loopIdle {
+		t.Errorf("Expected loop to be idle after stopping, got state %d", c.state)
+	}
+	c.mu.Unlock()
+}
+
+func TestServeContextCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		resp := []message.BayeuxMessage{{Channel: "/meta/connect", Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := c.ServeContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Errorf("Expected Connect to work after ServeContext returned, got %v", err)
+	}
+	c.Disconnect()
+}
+
+func TestConnectTimeoutFromAdvice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []message.BayeuxMessage{{
+			Channel:    "/meta/handshake",
+			ClientID:   "test-client-id",
+			Successful: boolPtr(true),
+			Advice:     &message.Advice{Reconnect: "retry", Timeout: 30000},
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	if got := c.connectRequestTimeout(); got != 0 {
+		t.Errorf("Expected no connect timeout before handshake, got %v", got)
+	}
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if got, want := c.connectRequestTimeout(), 30*time.Second+connectTimeoutMargin; got != want {
+		t.Errorf("Expected advised connect timeout %v, got %v", want, got)
+	}
+
+	c = NewClient(server.URL, WithConnectTimeout(5*time.Second))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if got := c.connectRequestTimeout(); got != 5*time.Second {
+		t.Errorf("Expected WithConnectTimeout to win over advice, got %v", got)
+	}
+}
+
+func TestResponseUnwrapper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := map[string]interface{}{
+			"status": "ok",
+			"messages": []message.BayeuxMessage{{
+				Channel:    "/meta/handshake",
+				ClientID:   "wrapped-client-id",
+				Successful: boolPtr(true),
+			}},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	unwrap := func(body []byte) ([]byte, error) {
+		var envelope struct {
+			Messages json.RawMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return nil, err
+		}
+		return envelope.Messages, nil
+	}
+
+	if err := NewClient(server.URL).Handshake(); err == nil {
+		t.Errorf("Expected a wrapped response to fail without an unwrapper")
+	}
+
+	c := NewClient(server.URL, WithResponseUnwrapper(unwrap))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if c.clientID != "wrapped-client-id" {
+		t.Errorf("Expected clientID 'wrapped-client-id', got %q", c.clientID)
+	}
+}
+
+func TestReady(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []message.BayeuxMessage{{Channel: "/meta/connect", ClientID: "test-client-id", Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	select {
+	case <-c.Ready():
+		t.Fatalf("Expected Ready to be open before the first connect")
+	default:
+	}
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	select {
+	case <-c.Ready():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Ready was not closed after connecting")
+	}
+	c.Disconnect()
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Reconnect failed: %v", err)
+	}
+	defer c.Disconnect()
+	select {
+	case <-c.Ready():
+	default:
+		t.Errorf("Expected Ready to stay closed across reconnects")
+	}
+}
+
+func TestConnectMetaMessagesNotDispatched(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []message.BayeuxMessage{
+			{Channel: "/meta/connect", Successful: boolPtr(true), Advice: &message.Advice{Reconnect: "retry", Interval: 250}},
+			{Channel: "/meta/subscribe", Successful: boolPtr(true), Subscription: "/foo"},
+			{Channel: "/foo", Data: map[string]interface{}{"msg": "hello"}},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	leaked := make(chan string, 2)
+	received := make(chan struct{}, 1)
+	for _, ch := range []string{"/meta/connect", "/meta/subscribe"} {
+		c.handlers[ch] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) { leaked <- ch }}}
+	}
+	c.handlers["/foo"] = []handlerEntry{{id: 2, handler: func(msg *message.BayeuxMessage) { received <- struct{}{} }}}
+
+	if err := c.connectOnce(context.Background()); err != nil {
+		t.Fatalf("connectOnce failed: %v", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatalf("Data message was not dispatched")
+	}
+	select {
+	case ch := <-leaked:
+		t.Errorf("Control message on %s leaked to a user handler", ch)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	c.mu.Lock()
+	advice := c.advice
+	c.mu.Unlock()
+	if advice == nil || advice.Interval != 250 {
+		t.Errorf("Expected connect advice to be recorded, got %+v", advice)
+	}
+}
+
+func TestConnectUnsuccessful(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []message.BayeuxMessage{{
+			Channel:    "/meta/connect",
+			Successful: boolPtr(false),
+			Error:      "402::Unknown client",
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "stale-client-id"
+
+	err := c.connectOnce(context.Background())
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Code != 402 {
+		t.Fatalf("Expected a 402 ServerError, got %v", err)
+	}
+	select {
+	case <-c.Ready():
+		t.Errorf("Expected an unsuccessful connect not to mark the client ready")
+	default:
+	}
+}
+
+func TestPublishRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []message.BayeuxMessage{{Channel: "/foo", Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithPublishRateLimit(20))
+	c.clientID = "test-client-id"
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := c.Publish("/foo", map[string]interface{}{"n": i}); err != nil {
+			t.Fatalf("Publish %d failed: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected 3 publishes at 20/s to take about 100ms, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.publish(ctx, "/foo", nil); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Errorf("Expected a rate limit error when the context expires, got %v", err)
+	}
+}
+
+func TestOrderedHandlers(t *testing.T) {
+	c := NewClient("http://example.com/bayeux", WithOrderedHandlers(true))
+
+	calls := make(chan []int, 20)
+	var mu sync.Mutex
+	order := map[string][]int{}
+	for i := 1; i <= 3; i++ {
+		c.handlers["/foo"] = append(c.handlers["/foo"], handlerEntry{id: i, handler: func(msg *message.BayeuxMessage) {
+			if i == 2 {
+				panic("handler 2 failed")
+			}
+			mu.Lock()
+			key := msg.ID
+			order[key] = append(order[key], i)
+			if len(order[key]) == 2 {
+				calls <- order[key]
+			}
+			mu.Unlock()
+		}})
+	}
+
+	for i := 0; i < 20; i++ {
+		c.dispatch(&message.BayeuxMessage{Channel: "/foo", ID: strconv.Itoa(i)})
+	}
+	for i := 0; i < 20; i++ {
+		select {
+		case got := <-calls:
+			if got[0] != 1 || got[1] != 3 {
+				t.Fatalf("Expected handlers to run in registration order, got %v", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Handlers not invoked within timeout")
+		}
+	}
+}
+
+func TestOnOutgoingAndIncoming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		resp := []message.BayeuxMessage{{
+			Channel:    reqMsgs[0].Channel,
+			ClientID:   "test-client-id",
+			Successful: boolPtr(true),
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	var outgoing, incoming []string
+	c := NewClient(server.URL,
+		OnOutgoing(func(msg *message.BayeuxMessage) { outgoing = append(outgoing, msg.Channel) }),
+		OnIncoming(func(msg *message.BayeuxMessage) { incoming = append(incoming, msg.Channel) }),
+	)
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if err := c.Publish("/foo", map[string]interface{}{"n": 1}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	want := []string{"/meta/handshake", "/foo"}
+	if !reflect.DeepEqual(outgoing, want) {
+		t.Errorf("Expected outgoing %v, got %v", want, outgoing)
+	}
+	if !reflect.DeepEqual(incoming, want) {
+		t.Errorf("Expected incoming %v, got %v", want, incoming)
+	}
+}
+
+func TestPollOnce(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/connect","successful":true},{"channel":"/foo","data":{"n":1}}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	received := make(chan *message.BayeuxMessage, 1)
+	c.handlers["/foo"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) { received <- msg }}}
+
+	if err := c.PollOnce(context.Background()); err != nil {
+		t.Fatalf("PollOnce failed: %v", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatalf("Message not dispatched by PollOnce")
+	}
+	if c.state != loopIdle {
+		t.Errorf("Expected PollOnce not to start the connect loop")
+	}
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Disconnect()
+	if err := c.PollOnce(context.Background()); err == nil {
+		t.Errorf("Expected PollOnce to fail while the connect loop runs")
+	}
+}
+
+func TestPollOnceHoldsTheLoop(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/connect","successful":true}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	polled := make(chan error, 1)
+	go func() { polled <- c.PollOnce(context.Background()) }()
+
+	deadline := time.Now().Add(time.Second)
+	for c.Info().State != "polling" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected PollOnce to hold the loop state")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Connect(); err == nil {
+		t.Errorf("Expected Connect to fail during PollOnce")
+	}
+	if err := c.PollOnce(context.Background()); err == nil {
+		t.Errorf("Expected a second PollOnce to fail during the first")
+	}
+
+	close(release)
+	if err := <-polled; err != nil {
+		t.Fatalf("PollOnce failed: %v", err)
+	}
+	if state := c.Info().State; state != "idle" {
+		t.Errorf("Expected PollOnce to release the loop state, got %s", state)
+	}
+}
+
+func TestSuccessInference(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		ack := message.BayeuxMessage{Channel: reqMsgs[0].Channel, Subscription: reqMsgs[0].Subscription}
+		if reqMsgs[0].Subscription == "/denied" {
+			ack.Error = "403::denied"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{ack})
+	}))
+	defer server.Close()
+
+	strict := NewClient(server.URL)
+	strict.clientID = "test-client-id"
+	if _, err := strict.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err == nil {
+		t.Errorf("Expected an ack without successful to fail by default")
+	}
+
+	lenient := NewClient(server.URL, WithSuccessInference(true))
+	lenient.clientID = "test-client-id"
+	if _, err := lenient.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Errorf("Expected an ack without successful or error to succeed, got %v", err)
+	}
+	if _, err := lenient.Subscribe("/denied", func(msg *message.BayeuxMessage) {}); err == nil {
+		t.Errorf("Expected an ack with an error to fail")
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		resp := []message.BayeuxMessage{{
+			Channel:      "/meta/subscribe",
+			Successful:   boolPtr(true),
+			Subscription: reqMsgs[0].Subscription,
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithMaxConcurrentRequests(2))
+	c.clientID = "test-client-id"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+				t.Errorf("Subscribe %d failed: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+	if len(c.requestSlots) != 0 {
+		t.Errorf("Expected every request slot to be released, %d still held", len(c.requestSlots))
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	slow := make(chan string, 1)
+	c := NewClient("http://example.com/bayeux",
+		WithOrderedHandlers(true),
+		WithHandlerTimeout(20*time.Millisecond),
+		OnSlowHandler(func(channel string, elapsed time.Duration) { slow <- channel }),
+	)
+
+	block := make(chan struct{})
+	defer close(block)
+	next := make(chan struct{}, 1)
+	c.handlers["/foo"] = []handlerEntry{
+		{id: 1, handler: func(msg *message.BayeuxMessage) { <-block }},
+		{id: 2, handler: func(msg *message.BayeuxMessage) { next <- struct{}{} }},
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+	select {
+	case channel := <-slow:
+		if channel != "/foo" {
+			t.Errorf("Expected slow handler on /foo, got %s", channel)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Slow handler not reported")
+	}
+	select {
+	case <-next:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the next handler to run after the slow one was abandoned")
+	}
+}
+
+func TestDisconnectCancelsPendingPoll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		if reqMsgs[0].Channel == "/meta/connect" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		resp := []message.BayeuxMessage{{Channel: reqMsgs[0].Channel, ClientID: "test-client-id", Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	c.Disconnect()
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect after an idle Disconnect failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+	c.Disconnect()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Disconnect to abort the pending long poll")
+	}
+}
+
+func TestHandlersGetPrivateData(t *testing.T) {
+	c := NewClient("http://example.com/bayeux", WithOrderedHandlers(true))
+
+	seen := make(chan map[string]interface{}, 1)
+	c.handlers["/foo"] = []handlerEntry{
+		{id: 1, handler: func(msg *message.BayeuxMessage) {
+			msg.Data["n"] = "mutated"
+			msg.Data["nested"].(map[string]interface{})["k"] = "mutated"
+		}},
+		{id: 2, handler: func(msg *message.BayeuxMessage) { seen <- msg.Data }},
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo", Data: map[string]interface{}{
+		"n":      1.0,
+		"nested": map[string]interface{}{"k": "v"},
+	}})
+	select {
+	case data := <-seen:
+		if data["n"] != 1.0 || data["nested"].(map[string]interface{})["k"] != "v" {
+			t.Errorf("Expected the second handler's data to be unaffected, got %+v", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Second handler not invoked")
+	}
+}
+
+func TestEmptyConnectBatchWaitsBeforeNextPoll(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		if reqMsgs[0].Channel == "/meta/connect" {
+			mu.Lock()
+			polls++
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if reqMsgs[0].Channel == "/meta/disconnect" {
+			json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: "/meta/disconnect", Successful: boolPtr(true)}})
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	keepalives := make(chan struct{}, 10)
+	c := NewClient(server.URL, WithMinConnectInterval(100*time.Millisecond), OnKeepalive(func() {
+		keepalives <- struct{}{}
+	}))
+	c.clientID = "test-client-id"
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	c.Disconnect()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if polls < 2 || polls > 4 {
+		t.Errorf("Expected empty batches to be paced by the interval, got %d polls", polls)
+	}
+	if len(keepalives) != polls {
+		t.Errorf("Expected a keepalive callback per empty batch, got %d for %d polls", len(keepalives), polls)
+	}
+}
+
+func TestAdvisedIntervalPacesPolls(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		if reqMsgs[0].Channel == "/meta/connect" {
+			mu.Lock()
+			polls++
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{
+			Channel:    reqMsgs[0].Channel,
+			Successful: boolPtr(true),
+			Advice:     &message.Advice{Reconnect: "retry", Interval: 100},
+		}})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	c.Disconnect()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if polls < 2 || polls > 4 {
+		t.Errorf("Expected acknowledged polls to be paced by the advised interval, got %d polls", polls)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	calls := map[string]func(ctx context.Context) error{
+		"HandshakeContext": c.HandshakeContext,
+		"SubscribeContext": func(ctx context.Context) error {
+			_, err := c.SubscribeContext(ctx, "/foo", func(msg *message.BayeuxMessage) {})
+			return err
+		},
+		"PublishContext": func(ctx context.Context) error {
+			return c.PublishContext(ctx, "/foo", nil)
+		},
+		"DisconnectContext": c.DisconnectContext,
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		start := time.Now()
+		if err := call(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected %s to return context.Canceled, got %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected %s to return promptly, took %v", name, elapsed)
+		}
+	}
+
+	c = NewClient(server.URL)
+	c.clientID = "test-client-id"
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := c.ConnectContext(ctx); err != nil {
+		t.Fatalf("ConnectContext failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Errorf("Expected cancelling the context to stop the pending poll at once")
+	}
+}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// preconditionFailedCode is the Bayeux error code a server uses to reject a
+// conditional publish whose version token is stale, after HTTP's 412.
+const preconditionFailedCode = 412
+
+// PublishIfMatch publishes data to channel only if the server's current
+// version of it is still version, which is sent as ext.ifMatch. A stale
+// version, reported by the server with error code 412, fails with an error
+// matching ErrPreconditionFailed that also wraps the *ServerError.
+func (c *Client) PublishIfMatch(channel string, data map[string]interface{}, version string) error {
+	err := c.publishExt(context.Background(), channel, data, map[string]interface{}{"ifMatch": version})
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) && serverErr.Code == preconditionFailedCode {
+		return fmt.Errorf("%w: %w", ErrPreconditionFailed, err)
+	}
+	return err
+}
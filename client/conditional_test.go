@@ -0,0 +1,42 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestPublishIfMatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []struct {
+			message.BayeuxMessage
+			Ext map[string]interface{} `json:"ext"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		ack := message.BayeuxMessage{Channel: "/doc", Successful: boolPtr(true)}
+		if reqMsgs[0].Ext["ifMatch"] != "v2" {
+			ack.Successful = boolPtr(false)
+			ack.Error = "412::stale version"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{ack})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	if err := c.PublishIfMatch("/doc", map[string]interface{}{"n": 1}, "v2"); err != nil {
+		t.Errorf("Expected a current version to be accepted, got %v", err)
+	}
+	err := c.PublishIfMatch("/doc", map[string]interface{}{"n": 1}, "v1")
+	var serverErr *ServerError
+	if !errors.Is(err, ErrPreconditionFailed) || !errors.As(err, &serverErr) {
+		t.Errorf("Expected ErrPreconditionFailed wrapping the server error, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// confirmSubscribe decides whether response acknowledges the subscribe
+// request, with the WithSubscribeConfirmer function if one is set and
+// otherwise from its successful flag.
+func (c *Client) confirmSubscribe(request, response *message.BayeuxMessage) error {
+	if c.subscribeConfirmer == nil {
+		if !c.succeeded(response) {
+			return newServerError(response)
+		}
+		return nil
+	}
+	ok, err := c.subscribeConfirmer(request, response)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return newServerError(response)
+	}
+	return nil
+}
+
+// confirmation returns the channel closed once the server has confirmed the
+// session's subscription to channel, creating it if needed. The caller must
+// hold confirmMu.
+func (c *Client) confirmation(channel string) chan struct{} {
+	ch, ok := c.confirmations[channel]
+	if !ok {
+		ch = make(chan struct{})
+		c.confirmations[channel] = ch
+	}
+	return ch
+}
+
+// confirmSubscription records that the server confirmed the subscription to
+// channel and wakes its WaitForSubscription callers.
+func (c *Client) confirmSubscription(channel string) {
+	c.confirmMu.Lock()
+	defer c.confirmMu.Unlock()
+	ch := c.confirmation(channel)
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// subscriptionConfirmed reports whether the server has confirmed the current
+// session's subscription to channel.
+func (c *Client) subscriptionConfirmed(channel string) bool {
+	c.confirmMu.Lock()
+	defer c.confirmMu.Unlock()
+	ch, ok := c.confirmations[channel]
+	if !ok {
+		return false
+	}
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// unconfirmSubscription forgets the confirmation of channel, once it has no
+// handlers left.
+func (c *Client) unconfirmSubscription(channel string) {
+	c.confirmMu.Lock()
+	defer c.confirmMu.Unlock()
+	if ch, ok := c.confirmations[channel]; ok {
+		select {
+		case <-ch:
+			delete(c.confirmations, channel)
+		default:
+		}
+	}
+}
+
+// resetConfirmations forgets every confirmation when a new session starts,
+// since the server knows nothing of the old session's subscriptions.
+func (c *Client) resetConfirmations() {
+	c.confirmMu.Lock()
+	defer c.confirmMu.Unlock()
+	for channel, ch := range c.confirmations {
+		select {
+		case <-ch:
+			delete(c.confirmations, channel)
+		default:
+		}
+	}
+}
+
+// WaitForSubscription blocks until the server has confirmed the current
+// session's subscription to channel, or ctx is done. It returns at once if
+// the subscription is already confirmed. After a new handshake it waits for
+// the channel to be subscribed again on the new session.
+func (c *Client) WaitForSubscription(ctx context.Context, channel string) error {
+	c.confirmMu.Lock()
+	ch := c.confirmation(channel)
+	c.confirmMu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Error waiting for the subscription to %s: %w", channel, ctx.Err())
+	}
+}
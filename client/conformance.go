@@ -0,0 +1,187 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// conformanceChannel is the channel CheckConformance subscribes and
+// publishes to.
+const conformanceChannel = "/galliard/conformance"
+
+// ConformanceCheck records how the server answered one scripted request of a
+// CheckConformance run.
+type ConformanceCheck struct {
+	Name string
+	// Deviation describes how the server departed from the Bayeux
+	// specification, empty when it conformed.
+	Deviation string
+	// Err is the failure that kept the check from getting an answer.
+	Err error
+}
+
+// Passed reports whether the server answered as the specification requires.
+func (c ConformanceCheck) Passed() bool {
+	return c.Err == nil && c.Deviation == ""
+}
+
+// ConformanceReport summarizes a CheckConformance run against a server.
+type ConformanceReport struct {
+	ServerURL string
+	Checks    []ConformanceCheck
+}
+
+// Conforms reports whether every check of the run passed.
+func (r *ConformanceReport) Conforms() bool {
+	for _, check := range r.Checks {
+		if !check.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckConformance runs a scripted sequence of requests against the current
+// server and records how it answers each against the Bayeux specification: a
+// handshake without version, which must be rejected, a proper handshake, a
+// subscribe to a valid and to an invalid channel, a publish, a connect, a
+// disconnect and a connect with the disconnected, stale client id, which must
+// be rejected with a reconnect:"handshake" advice. The requests are built by
+// hand rather than by the client's own methods, so that its retries and
+// recovery do not hide the server's answers, and are sent on a separate
+// session. The report is always returned; the error is set when the handshake
+// failed and the checks needing a session could not run.
+func (c *Client) CheckConformance(ctx context.Context) (*ConformanceReport, error) {
+	serverURL := c.ServerURL()
+	probe := c.newProbe(serverURL)
+	report := &ConformanceReport{ServerURL: serverURL}
+
+	run := func(name string, req map[string]interface{}, wantSuccess bool, verify func(ack *knownFields) string) *knownFields {
+		ack, err := probe.conformanceExchange(ctx, req)
+		check := ConformanceCheck{Name: name}
+		var httpErr *HTTPError
+		switch {
+		case !wantSuccess && errors.As(err, &httpErr) && httpErr.StatusCode < 500:
+		case err != nil:
+			check.Err = err
+		case ack.Successful == nil:
+			check.Deviation = "response has no successful field"
+		case wantSuccess && !*ack.Successful:
+			check.Deviation = fmt.Sprintf("request rejected: %s", ack.Error)
+		case !wantSuccess && *ack.Successful:
+			check.Deviation = "request accepted"
+		case verify != nil:
+			check.Deviation = verify(ack)
+		}
+		report.Checks = append(report.Checks, check)
+		return ack
+	}
+	disconnect := func(clientID string) map[string]interface{} {
+		return map[string]interface{}{"channel": "/meta/disconnect", "clientId": clientID}
+	}
+
+	if ack := run("handshake without version", map[string]interface{}{"channel": "/meta/handshake"}, false, nil); ack != nil && ack.ClientID != "" && ack.Successful != nil && *ack.Successful {
+		probe.conformanceExchange(ctx, disconnect(ack.ClientID))
+	}
+
+	ack := run("handshake", map[string]interface{}{
+		"channel":                  "/meta/handshake",
+		"version":                  BayeuxVersion,
+		"supportedConnectionTypes": probe.connectionTypes,
+	}, true, func(ack *knownFields) string {
+		switch {
+		case ack.ClientID == "":
+			return "response has no clientId"
+		case len(ack.Version) == 0:
+			return "response has no version"
+		case len(ack.SupportedConnectionTypes) == 0:
+			return "response has no supportedConnectionTypes"
+		}
+		return ""
+	})
+	if ack == nil || ack.ClientID == "" || ack.Successful == nil || !*ack.Successful {
+		return report, fmt.Errorf("Error on the conformance handshake check: no session to run the other checks on")
+	}
+	clientID := ack.ClientID
+
+	run("subscribe", map[string]interface{}{
+		"channel":      "/meta/subscribe",
+		"clientId":     clientID,
+		"subscription": conformanceChannel,
+	}, true, func(ack *knownFields) string {
+		if ack.Subscription != conformanceChannel {
+			return fmt.Sprintf("response has subscription %q instead of %q", ack.Subscription, conformanceChannel)
+		}
+		return ""
+	})
+	run("subscribe to invalid channel", map[string]interface{}{
+		"channel":      "/meta/subscribe",
+		"clientId":     clientID,
+		"subscription": "galliard-conformance",
+	}, false, nil)
+	run("publish", map[string]interface{}{
+		"channel":  conformanceChannel,
+		"clientId": clientID,
+		"id":       "conformance",
+		"data":     map[string]interface{}{"conformance": clientID},
+	}, true, nil)
+	run("connect", map[string]interface{}{
+		"channel":        "/meta/connect",
+		"clientId":       clientID,
+		"connectionType": "long-polling",
+		"advice":         map[string]interface{}{"timeout": 0},
+	}, true, nil)
+	run("disconnect", disconnect(clientID), true, nil)
+	run("connect with stale clientId", map[string]interface{}{
+		"channel":        "/meta/connect",
+		"clientId":       clientID,
+		"connectionType": "long-polling",
+		"advice":         map[string]interface{}{"timeout": 0},
+	}, false, func(ack *knownFields) string {
+		if ack.Advice == nil || ack.Advice.Reconnect != "handshake" {
+			return "rejection has no reconnect:\"handshake\" advice"
+		}
+		return ""
+	})
+
+	return report, nil
+}
+
+// conformanceExchange sends req on its own and returns the response message
+// on the same channel, preferring one with a successful field over a
+// delivered message, decoded without the extensions and hooks that might
+// mask the server's answer.
+func (c *Client) conformanceExchange(ctx context.Context, req map[string]interface{}) (*knownFields, error) {
+	reqBody, err := json.Marshal([]map[string]interface{}{req})
+	if err != nil {
+		return nil, fmt.Errorf("Error during request marshal: %w", err)
+	}
+	resp, err := c.post(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var respMsgs []knownFields
+	if err := json.NewDecoder(resp.Body).Decode(&respMsgs); err != nil {
+		return nil, fmt.Errorf("Error decoding the message: %w", err)
+	}
+	var match *knownFields
+	for i := range respMsgs {
+		if respMsgs[i].Channel != req["channel"] {
+			continue
+		}
+		if respMsgs[i].Successful != nil {
+			return &respMsgs[i], nil
+		}
+		if match == nil {
+			match = &respMsgs[i]
+		}
+	}
+	if match == nil {
+		return nil, errEmptyResponse
+	}
+	return match, nil
+}
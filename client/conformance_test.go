@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newConformanceServer returns a server answering the CheckConformance
+// script, as the Bayeux specification requires if strict is set, accepting
+// every request otherwise.
+func newConformanceServer(strict bool) *httptest.Server {
+	var mu sync.Mutex
+	sessions := map[string]bool{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		req := reqMsgs[0]
+		channel, _ := req["channel"].(string)
+		clientID, _ := req["clientId"].(string)
+
+		mu.Lock()
+		defer mu.Unlock()
+		resp := map[string]interface{}{"channel": channel, "successful": true}
+		switch {
+		case !strict:
+			if channel == "/meta/handshake" {
+				resp["clientId"] = "lenient-client"
+			}
+		case channel == "/meta/handshake" && req["version"] == nil:
+			resp["successful"] = false
+			resp["error"] = "400::version missing"
+		case channel == "/meta/handshake":
+			resp["clientId"] = "strict-client"
+			resp["version"] = "1.0"
+			resp["supportedConnectionTypes"] = []string{"long-polling"}
+			sessions["strict-client"] = true
+		case !sessions[clientID]:
+			resp["successful"] = false
+			resp["error"] = "402::Unknown client"
+			resp["advice"] = map[string]interface{}{"reconnect": "handshake"}
+		case channel == "/meta/subscribe":
+			resp["subscription"] = req["subscription"]
+			if sub, _ := req["subscription"].(string); !strings.HasPrefix(sub, "/") {
+				resp["successful"] = false
+				resp["error"] = "400::invalid channel"
+			}
+		case channel == "/meta/disconnect":
+			delete(sessions, clientID)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]map[string]interface{}{resp})
+	}))
+}
+
+func TestCheckConformance(t *testing.T) {
+	server := newConformanceServer(true)
+	defer server.Close()
+
+	report, err := NewClient(server.URL).CheckConformance(context.Background())
+	if err != nil {
+		t.Fatalf("CheckConformance failed: %v", err)
+	}
+	if !report.Conforms() {
+		t.Errorf("Expected a conforming server to pass every check, got %+v", report.Checks)
+	}
+	if len(report.Checks) != 8 {
+		t.Errorf("Expected 8 checks, got %d", len(report.Checks))
+	}
+}
+
+func TestCheckConformanceDeviations(t *testing.T) {
+	server := newConformanceServer(false)
+	defer server.Close()
+
+	report, err := NewClient(server.URL).CheckConformance(context.Background())
+	if err != nil {
+		t.Fatalf("CheckConformance failed: %v", err)
+	}
+	failed := map[string]bool{}
+	for _, check := range report.Checks {
+		if !check.Passed() {
+			failed[check.Name] = true
+		}
+	}
+	for _, name := range []string{"handshake without version", "handshake", "subscribe", "subscribe to invalid channel", "connect with stale clientId"} {
+		if !failed[name] {
+			t.Errorf("Expected the %q check to flag a deviation", name)
+		}
+	}
+	for _, name := range []string{"publish", "connect", "disconnect"} {
+		if failed[name] {
+			t.Errorf("Expected the %q check to pass", name)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"time"
+)
+
+// ConnectionTiming breaks a request's duration down into connection setup
+// and server round trip, as reported to OnConnectionTiming under
+// WithHTTPTrace.
+type ConnectionTiming struct {
+	// Reused is true when the request went out on a pooled connection, in
+	// which case DNS, Connect and TLS are zero.
+	Reused bool
+	// DNS, Connect and TLS are the durations of the name lookup, the TCP
+	// connect and the TLS handshake of a new connection.
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// RoundTrip runs from the request being written to the first response
+	// byte, covering the server's processing.
+	RoundTrip time.Duration
+	// Total is the whole time until the response headers arrived.
+	Total time.Duration
+}
+
+// connectionTracer collects the httptrace events of one request.
+type connectionTracer struct {
+	start                  time.Time
+	dnsStart, connectStart time.Time
+	tlsStart, wroteRequest time.Time
+	timing                 ConnectionTiming
+}
+
+// traceConnection returns ctx instrumented to record the connection phases
+// of the request made with it.
+func traceConnection(ctx context.Context) (context.Context, *connectionTracer) {
+	t := &connectionTracer{start: time.Now()}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.timing.Reused = info.Reused
+		},
+		DNSStart: func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.timing.DNS = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(string, string) { t.connectStart = time.Now() },
+		ConnectDone: func(string, string, error) {
+			t.timing.Connect = time.Since(t.connectStart)
+		},
+		TLSHandshakeStart: func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.timing.TLS = time.Since(t.tlsStart)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { t.wroteRequest = time.Now() },
+		GotFirstResponseByte: func() {
+			if !t.wroteRequest.IsZero() {
+				t.timing.RoundTrip = time.Since(t.wroteRequest)
+			}
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// done completes the timing once the response headers have arrived.
+func (t *connectionTracer) done() ConnectionTiming {
+	t.timing.Total = time.Since(t.start)
+	return t.timing
+}
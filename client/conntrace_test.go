@@ -0,0 +1,38 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/foo","successful":true}]`))
+	}))
+	defer server.Close()
+
+	var timings []ConnectionTiming
+	// WithTLSHandshakeTimeout gives the client a private transport, so the
+	// first request cannot reuse another test's pooled connection.
+	c := NewClient(server.URL, WithHTTPTrace(true), WithTLSHandshakeTimeout(0), OnConnectionTiming(func(ct ConnectionTiming) {
+		timings = append(timings, ct)
+	}))
+	c.clientID = "test-client-id"
+	for i := 0; i < 2; i++ {
+		if err := c.Publish("/foo", map[string]interface{}{"n": i}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	if len(timings) != 2 {
+		t.Fatalf("Expected a timing per request, got %d", len(timings))
+	}
+	if first := timings[0]; first.Reused || first.Connect <= 0 || first.Total < first.Connect {
+		t.Errorf("Expected the first request to time a new connection, got %+v", first)
+	}
+	if second := timings[1]; !second.Reused || second.Connect != 0 {
+		t.Errorf("Expected the second request to reuse the connection, got %+v", second)
+	}
+}
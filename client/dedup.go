@@ -0,0 +1,56 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+)
+
+// publishDigest returns the content hash WithPublishDedup compares publishes
+// by, covering the ext object so that publishes with different conditions,
+// such as PublishIfMatch versions, never match. encoding/json sorts map keys,
+// so equal content always hashes the same.
+func publishDigest(channel string, data, ext map[string]interface{}) ([sha256.Size]byte, error) {
+	raw, err := json.Marshal([]map[string]interface{}{data, ext})
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(append([]byte(channel+"\x00"), raw...)), nil
+}
+
+// checkDuplicate records a publish of data with ext to channel and reports
+// ErrDuplicateSuppressed if the same content was published within the
+// WithPublishDedup window. The returned forget undoes the record, for a
+// publish that failed. Expired entries are swept at most once per window.
+func (c *Client) checkDuplicate(channel string, data, ext map[string]interface{}) (forget func(), err error) {
+	if c.dedupWindow <= 0 {
+		return func() {}, nil
+	}
+	digest, err := publishDigest(channel, data, ext)
+	if err != nil {
+		return func() {}, nil
+	}
+
+	c.dedupMu.Lock()
+	defer c.dedupMu.Unlock()
+	now := time.Now()
+	if now.Sub(c.dedupSwept) >= c.dedupWindow {
+		for d, at := range c.dedupSeen {
+			if now.Sub(at) >= c.dedupWindow {
+				delete(c.dedupSeen, d)
+			}
+		}
+		c.dedupSwept = now
+	}
+	if at, ok := c.dedupSeen[digest]; ok && now.Sub(at) < c.dedupWindow {
+		return nil, ErrDuplicateSuppressed
+	}
+	c.dedupSeen[digest] = now
+	return func() {
+		c.dedupMu.Lock()
+		defer c.dedupMu.Unlock()
+		if c.dedupSeen[digest] == now {
+			delete(c.dedupSeen, digest)
+		}
+	}, nil
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPublishDedup(t *testing.T) {
+	published := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		published++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/foo","successful":true}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithPublishDedup(50*time.Millisecond))
+	c.clientID = "test-client-id"
+
+	if err := c.Publish("/foo", map[string]interface{}{"a": 1, "b": 2}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := c.Publish("/foo", map[string]interface{}{"b": 2, "a": 1}); !errors.Is(err, ErrDuplicateSuppressed) {
+		t.Errorf("Expected the same data to be suppressed, got %v", err)
+	}
+	if err := c.Publish("/bar", map[string]interface{}{"a": 1, "b": 2}); err != nil {
+		t.Errorf("Expected another channel not to be a duplicate, got %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := c.Publish("/foo", map[string]interface{}{"a": 1, "b": 2}); err != nil {
+		t.Errorf("Expected a publish after the window to go through, got %v", err)
+	}
+	if published != 3 {
+		t.Errorf("Expected 3 publishes to reach the server, got %d", published)
+	}
+}
+
+func TestPublishDedupForgetsFailures(t *testing.T) {
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if fail {
+			w.Write([]byte(`[{"channel":"/foo","successful":false,"error":"500::busy"}]`))
+			return
+		}
+		w.Write([]byte(`[{"channel":"/foo","successful":true}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithPublishDedup(time.Minute))
+	c.clientID = "test-client-id"
+
+	data := map[string]interface{}{"a": 1}
+	if err := c.Publish("/foo", data); err == nil || errors.Is(err, ErrDuplicateSuppressed) {
+		t.Fatalf("Expected the first publish to fail at the server, got %v", err)
+	}
+	fail = false
+	if err := c.Publish("/foo", data); err != nil {
+		t.Errorf("Expected the retry of a failed publish to go through, got %v", err)
+	}
+	if err := c.Publish("/foo", data); !errors.Is(err, ErrDuplicateSuppressed) {
+		t.Errorf("Expected a publish after the successful one to be suppressed, got %v", err)
+	}
+}
+
+func TestPublishDedupKeepsVersions(t *testing.T) {
+	published := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		published++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/foo","successful":true}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithPublishDedup(time.Minute))
+	c.clientID = "test-client-id"
+
+	data := map[string]interface{}{"a": 1}
+	if err := c.PublishIfMatch("/foo", data, "v1"); err != nil {
+		t.Fatalf("PublishIfMatch failed: %v", err)
+	}
+	if err := c.PublishIfMatch("/foo", data, "v2"); err != nil {
+		t.Errorf("Expected a new version of the same data not to be a duplicate, got %v", err)
+	}
+	if err := c.PublishIfMatch("/foo", data, "v2"); !errors.Is(err, ErrDuplicateSuppressed) {
+		t.Errorf("Expected a repeat of the same version to be suppressed, got %v", err)
+	}
+	if published != 2 {
+		t.Errorf("Expected 2 publishes to reach the server, got %d", published)
+	}
+}
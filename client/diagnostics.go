@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// diagnosticsChannel is the channel Diagnose subscribes and publishes to.
+const diagnosticsChannel = "/galliard/diagnostics"
+
+// diagnosticsDeliveryWait bounds how long Diagnose waits for the published
+// probe to reach its handler after the connect cycle returns.
+const diagnosticsDeliveryWait = time.Second
+
+// diagnosticsCleanupTimeout bounds the disconnect that ends a Diagnose run,
+// which still runs when ctx has already been cancelled.
+const diagnosticsCleanupTimeout = 5 * time.Second
+
+// DiagnosticStep records the outcome of a single step of a Diagnose run.
+type DiagnosticStep struct {
+	Name    string
+	Latency time.Duration
+	Err     error
+}
+
+// DiagnosticsReport summarizes a Diagnose run against a server.
+type DiagnosticsReport struct {
+	ServerURL string
+	ClientID  string
+	Steps     []DiagnosticStep
+	// Delivered reports whether the probe message published during the run
+	// came back through the connect cycle.
+	Delivered bool
+}
+
+// OK reports whether every step of the run succeeded.
+func (r *DiagnosticsReport) OK() bool {
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// newProbe returns a client for a throwaway session on serverURL, built with
+// this client's options so that it reaches the server the same way: HTTP
+// client and transport, request building, extensions and handshake ext. The
+// hooks, listeners and sinks the application observes its own session
+// through are cleared, and the probe gets a subscription store of its own,
+// so that a probe run is invisible to the application. Server lists, server
+// racing and the startup buffer are turned off, so that the probe talks to
+// serverURL alone and sees its messages at once.
+func (c *Client) newProbe(serverURL string) *Client {
+	probe := NewClient(serverURL, c.opts...)
+	probe.serverURL = serverURL
+	probe.serverURLs = nil
+	probe.serverIndex = 0
+	probe.fastestServer = false
+	probe.startupBufferSize = 0
+	probe.store = NewMemorySubscriptionStore()
+	probe.stateListener = nil
+	probe.onIncoming = nil
+	probe.onOutgoing = nil
+	probe.errorHandler = nil
+	probe.errorWriter = nil
+	probe.livenessWriter = nil
+	probe.tracer = nil
+	probe.onConnectionTiming = nil
+	probe.onKeepalive = nil
+	probe.onClientIDChange = nil
+	probe.onOrphanedSubscription = nil
+	probe.onSlowHandler = nil
+	probe.onUnhandled = nil
+	probe.onSequenceGap = nil
+	probe.extensionErrorHandler = nil
+	return probe
+}
+
+// Diagnose validates connectivity to the current server by performing a
+// handshake, a subscribe to a test channel, a publish and a connect cycle,
+// timing each step. It runs on a separate session so the client's own
+// subscriptions are left untouched, and disconnects that session when done.
+// The report is always returned; the error is the first step that failed.
+func (c *Client) Diagnose(ctx context.Context) (*DiagnosticsReport, error) {
+	serverURL := c.ServerURL()
+	probe := c.newProbe(serverURL)
+	report := &DiagnosticsReport{ServerURL: serverURL}
+
+	var firstErr error
+	step := func(name string, fn func() error) bool {
+		if firstErr != nil {
+			return false
+		}
+		start := time.Now()
+		err := ctx.Err()
+		if err == nil {
+			err = fn()
+		}
+		report.Steps = append(report.Steps, DiagnosticStep{Name: name, Latency: time.Since(start), Err: err})
+		if err != nil {
+			firstErr = fmt.Errorf("Error on the diagnostics %s step: %w", name, err)
+			return false
+		}
+		return true
+	}
+
+	if !step("handshake", func() error { return probe.handshake(ctx) }) {
+		return report, firstErr
+	}
+	report.ClientID = probe.getClientID()
+
+	delivered := make(chan struct{}, 1)
+	var sub Subscription
+	step("subscribe", func() error {
+		var err error
+		sub, err = probe.subscribe(ctx, diagnosticsChannel, nil, func(_ Subscription, msg *message.BayeuxMessage) {
+			select {
+			case delivered <- struct{}{}:
+			default:
+			}
+		})
+		return err
+	})
+	step("publish", func() error {
+		return probe.publish(ctx, diagnosticsChannel, map[string]interface{}{"diagnostics": probe.getClientID()})
+	})
+	if step("connect", func() error { return probe.connectOnce(ctx) }) {
+		select {
+		case <-delivered:
+			report.Delivered = true
+		case <-time.After(diagnosticsDeliveryWait):
+		case <-ctx.Done():
+		}
+	}
+
+	if sub != nil {
+		sub.Unsubscribe()
+	}
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), diagnosticsCleanupTimeout)
+	defer cancel()
+	start := time.Now()
+	err := probe.disconnect(cleanupCtx)
+	report.Steps = append(report.Steps, DiagnosticStep{Name: "disconnect", Latency: time.Since(start), Err: err})
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("Error on the diagnostics disconnect step: %w", err)
+	}
+
+	return report, firstErr
+}
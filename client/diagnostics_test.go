@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestDiagnose(t *testing.T) {
+	var mu sync.Mutex
+	var queued []message.BayeuxMessage
+	var channels []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		defer mu.Unlock()
+		req := reqMsgs[0]
+		channels = append(channels, req.Channel)
+
+		resp := []message.BayeuxMessage{{Channel: req.Channel, Successful: boolPtr(true), ClientID: "diag-client"}}
+		switch req.Channel {
+		case "/meta/connect":
+			resp = append(resp, queued...)
+			queued = nil
+		case diagnosticsChannel:
+			queued = append(queued, req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	report, err := c.Diagnose(context.Background())
+	if err != nil {
+		t.Fatalf("Diagnose failed: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("Expected report to be OK, got %+v", report.Steps)
+	}
+	if !report.Delivered {
+		t.Errorf("Expected probe message to be delivered")
+	}
+	if report.ClientID != "diag-client" {
+		t.Errorf("Expected clientID 'diag-client', got %q", report.ClientID)
+	}
+	if c.clientID != "" {
+		t.Errorf("Diagnose should not touch the client's own session, got clientID %q", c.clientID)
+	}
+
+	want := []string{"/meta/handshake", "/meta/subscribe", diagnosticsChannel, "/meta/connect", "/meta/unsubscribe", "/meta/disconnect"}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(channels) != len(want) {
+		t.Fatalf("Expected requests %v, got %v", want, channels)
+	}
+	for i := range want {
+		if channels[i] != want[i] {
+			t.Errorf("Expected request %d on %q, got %q", i, want[i], channels[i])
+		}
+	}
+}
+
+func TestDiagnoseHandshakeFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []message.BayeuxMessage{{
+			Channel:    "/meta/handshake",
+			Successful: boolPtr(false),
+			Error:      "Handshake failed",
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	report, err := c.Diagnose(context.Background())
+	if err == nil {
+		t.Fatalf("Expected Diagnose to fail")
+	}
+	if report.OK() {
+		t.Errorf("Expected report to record the failure")
+	}
+	if len(report.Steps) != 1 || report.Steps[0].Name != "handshake" {
+		t.Errorf("Expected only the handshake step, got %+v", report.Steps)
+	}
+}
+
+func TestDiagnoseLeavesApplicationHooksAlone(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		req := reqMsgs[0]
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: req.Channel, Subscription: req.Subscription, Successful: boolPtr(true), ClientID: "diag-client"}})
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var fired []string
+	record := func(name string) {
+		mu.Lock()
+		fired = append(fired, name)
+		mu.Unlock()
+	}
+	store := NewMemorySubscriptionStore()
+	c := NewClient(server.URL,
+		WithSubscriptionStore(store),
+		WithStateListener(func(old, new ConnectionState) { record("state") }),
+		OnIncoming(func(msg *message.BayeuxMessage) { record("incoming") }),
+		OnOutgoing(func(msg *message.BayeuxMessage) { record("outgoing") }),
+	)
+
+	if _, err := c.Diagnose(context.Background()); err != nil {
+		t.Fatalf("Diagnose failed: %v", err)
+	}
+	c.CheckConformance(context.Background())
+	mu.Lock()
+	defer mu.Unlock()
+	if len(fired) != 0 {
+		t.Errorf("Expected no application hook to fire during probe runs, got %v", fired)
+	}
+	if got := store.List(); len(got) != 0 {
+		t.Errorf("Expected the application's subscription store to stay empty, got %v", got)
+	}
+}
+
+func TestDiagnoseProbesTheCurrentServerOnly(t *testing.T) {
+	current := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		req := reqMsgs[0]
+		resp := []message.BayeuxMessage{{Channel: req.Channel, Subscription: req.Subscription, Successful: boolPtr(true), ClientID: "diag-client"}}
+		switch req.Channel {
+		case "/meta/handshake":
+			time.Sleep(30 * time.Millisecond)
+		case "/meta/connect":
+			resp = append(resp, message.BayeuxMessage{Channel: diagnosticsChannel, Data: map[string]interface{}{"diagnostics": "diag-client"}})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer current.Close()
+	var mu sync.Mutex
+	otherRequests := 0
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		otherRequests++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/handshake","successful":true,"clientId":"other-client"}]`))
+	}))
+	defer other.Close()
+
+	c := NewClient(current.URL, WithServerURLs([]string{current.URL, other.URL}), WithFastestServer(true), WithStartupBuffer(10))
+	report, err := c.Diagnose(context.Background())
+	if err != nil {
+		t.Fatalf("Diagnose failed: %v", err)
+	}
+	if report.ServerURL != current.URL || report.ClientID != "diag-client" {
+		t.Errorf("Expected a session on the current server, got %s on %s", report.ClientID, report.ServerURL)
+	}
+	if !report.Delivered {
+		t.Errorf("Expected the probe's message not to be held by the startup buffer")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if otherRequests != 0 {
+		t.Errorf("Expected no request to the other server, got %d", otherRequests)
+	}
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// errEmptyResponse is returned when the server answers with an empty batch
+// where an acknowledgement was expected.
+var errEmptyResponse = errors.New("empty response")
+
+// ErrPublishBufferFull is returned by Publish when it would be held back
+// during a reconnect but WithBufferPublishesDuringReconnect's limit has been
+// reached.
+var ErrPublishBufferFull = errors.New("publish buffer full during reconnect")
+
+// ErrDuplicateSuppressed is returned by Publish when WithPublishDedup finds
+// that the same data was published to the same channel within its window.
+var ErrDuplicateSuppressed = errors.New("duplicate publish suppressed")
+
+// ErrPreconditionFailed is returned by PublishIfMatch when the server
+// rejects the publish because its version token is stale.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrTooManySubscriptions is returned by Subscribe when the handler would
+// exceed the WithMaxSubscriptions or WithMaxHandlers limit.
+var ErrTooManySubscriptions = errors.New("too many subscriptions")
+
+// ErrStopSubscription is returned by a SubscribeUntil handler to remove
+// itself.
+var ErrStopSubscription = errors.New("stop subscription")
+
+// ErrSessionExpired matches, through errors.Is, a ServerError by which the
+// server says the session is gone and a new handshake is needed: a
+// reconnect:"handshake" advice or a 401 or 402 error code. It can come from
+// Subscribe and Publish as well as from the connect loop.
+var ErrSessionExpired = errors.New("session expired")
+
+// ErrUnknownField is matched by the error of a response rejected under
+// WithStrictDecode because a message carries a field the client does not
+// know.
+var ErrUnknownField = errors.New("unknown field in response")
+
+// ServerError reports a Bayeux response whose successful field was not true.
+// It is a definitive answer from the server, so it is never retried.
+type ServerError struct {
+	// Channel is the channel of the failed response.
+	Channel string
+	// Code, Args and Message are parsed from a "code:args:message" error
+	// string. Code is zero when the server used another format, in which case
+	// Message holds the raw error.
+	Code    int
+	Args    []string
+	Message string
+	// Advice is the advice the server attached to the failure, if any.
+	Advice *message.Advice
+}
+
+func (e *ServerError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s: %d:%s:%s", e.Channel, e.Code, strings.Join(e.Args, ","), e.Message)
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("%s: unsuccessful response", e.Channel)
+	}
+	return fmt.Sprintf("%s: %s", e.Channel, e.Message)
+}
+
+// Is makes a ServerError advising a new handshake match ErrSessionExpired.
+func (e *ServerError) Is(target error) bool {
+	return target == ErrSessionExpired && needsHandshake(e)
+}
+
+// newServerError builds a ServerError from an unsuccessful response.
+func newServerError(msg *message.BayeuxMessage) *ServerError {
+	e := &ServerError{Channel: msg.Channel, Message: msg.Error, Advice: msg.Advice}
+	parts := strings.SplitN(msg.Error, ":", 3)
+	if len(parts) == 3 {
+		if code, err := strconv.Atoi(parts[0]); err == nil {
+			e.Code = code
+			if parts[1] != "" {
+				e.Args = strings.Split(parts[1], ",")
+			}
+			e.Message = parts[2]
+		}
+	}
+	return e
+}
+
+// responseError describes why an acknowledgement batch was not successful.
+func responseError(respMsgs []message.BayeuxMessage) error {
+	if len(respMsgs) == 0 {
+		return errEmptyResponse
+	}
+	return newServerError(&respMsgs[0])
+}
+
+// LoopPanicError reports a panic recovered on the connect loop goroutine,
+// outside of any handler.
+type LoopPanicError struct {
+	Value interface{}
+}
+
+func (e *LoopPanicError) Error() string {
+	return fmt.Sprintf("panic in the connect loop: %v", e.Value)
+}
+
+// isLoopPanic reports whether err is a recovered connect loop panic.
+func isLoopPanic(err error) bool {
+	var panicErr *LoopPanicError
+	return errors.As(err, &panicErr)
+}
+
+// HTTPError reports a non-2xx HTTP status from the server.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	// Response is the failed response, with its body already closed.
+	Response *http.Response
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %s", e.Status)
+}
+
+// IncompleteResponseError reports a response body that ended before a whole
+// message batch was read, typically a chunked response cut off mid-stream.
+// The request may have been processed, but its answer was lost, so it is
+// treated as transient.
+type IncompleteResponseError struct {
+	Err error
+}
+
+func (e *IncompleteResponseError) Error() string {
+	return fmt.Sprintf("incomplete response: %v", e.Err)
+}
+
+func (e *IncompleteResponseError) Unwrap() error { return e.Err }
+
+// incomplete wraps err in an IncompleteResponseError when it reports a body
+// that was cut off.
+func incomplete(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return &IncompleteResponseError{Err: err}
+	}
+	return err
+}
+
+// IsTransient reports whether err is a failure that may succeed if the
+// request is retried: network errors, timeouts, incomplete responses, 429
+// and 5xx responses.
+// Server rejections (ServerError) and caller cancellation are terminal.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+	}
+	var incompleteErr *IncompleteResponseError
+	if errors.As(err, &incompleteErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestNewServerError(t *testing.T) {
+	err := newServerError(&message.BayeuxMessage{Channel: "/meta/connect", Error: "402:abc,def:Unknown client"})
+	if err.Code != 402 {
+		t.Errorf("Expected code 402, got %d", err.Code)
+	}
+	if len(err.Args) != 2 || err.Args[0] != "abc" || err.Args[1] != "def" {
+		t.Errorf("Expected args [abc def], got %v", err.Args)
+	}
+	if err.Message != "Unknown client" {
+		t.Errorf("Expected message 'Unknown client', got %q", err.Message)
+	}
+
+	err = newServerError(&message.BayeuxMessage{Channel: "/foo", Error: "Publish failed"})
+	if err.Code != 0 || err.Message != "Publish failed" {
+		t.Errorf("Expected raw message to be kept, got %+v", err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"server rejection", fmt.Errorf("wrapped: %w", &ServerError{Channel: "/foo"}), false},
+		{"service unavailable", &HTTPError{StatusCode: 503}, true},
+		{"too many requests", &HTTPError{StatusCode: 429}, true},
+		{"bad request", &HTTPError{StatusCode: 400}, false},
+		{"network timeout", fmt.Errorf("wrapped: %w", timeoutError{}), true},
+		{"incomplete response", fmt.Errorf("wrapped: %w", &IncompleteResponseError{Err: io.ErrUnexpectedEOF}), true},
+		{"cancelled", context.Canceled, false},
+		{"other", io.EOF, false},
+	}
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("%s: expected IsTransient %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	if err := responseError(nil); !errors.Is(err, errEmptyResponse) {
+		t.Errorf("Expected errEmptyResponse, got %v", err)
+	}
+	var serverErr *ServerError
+	if err := responseError([]message.BayeuxMessage{{Channel: "/foo", Error: "denied"}}); !errors.As(err, &serverErr) {
+		t.Errorf("Expected ServerError, got %v", err)
+	}
+}
+
+func TestIncompleteResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/connect","succ`))
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	err := c.connectOnce(context.Background())
+	var incompleteErr *IncompleteResponseError
+	if !errors.As(err, &incompleteErr) {
+		t.Fatalf("Expected an IncompleteResponseError, got %v", err)
+	}
+	if defaultConnectClassifier(err, nil) != Retry || !IsTransient(err) {
+		t.Errorf("Expected an incomplete response to be retried")
+	}
+}
+
+func TestSessionExpiredAdvice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		resp := message.BayeuxMessage{Channel: reqMsgs[0].Channel, Successful: boolPtr(false), Error: "session gone"}
+		resp.Advice = &message.Advice{Reconnect: "handshake", Interval: 250}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{resp})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	_, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	if !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Expected Subscribe to report ErrSessionExpired, got %v", err)
+	}
+	if err := c.Publish("/foo", nil); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Expected Publish to report ErrSessionExpired, got %v", err)
+	}
+	c.mu.Lock()
+	advice := c.advice
+	c.mu.Unlock()
+	if advice == nil || advice.Interval != 250 {
+		t.Errorf("Expected the response advice to be kept, got %+v", advice)
+	}
+	if errors.Is(&ServerError{Channel: "/foo", Message: "denied"}, ErrSessionExpired) {
+		t.Errorf("Expected a plain rejection not to match ErrSessionExpired")
+	}
+}
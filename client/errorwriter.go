@@ -0,0 +1,121 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reportError passes a connect loop error to the WithErrorHandler callback
+// and writes it to the WithErrorWriter sink, when either is set.
+func (c *Client) reportError(channel string, err error) {
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+	if c.errorWriter != nil {
+		c.writeErrorLine(c.errorWriter, channel, nil, "error", err.Error())
+	}
+}
+
+// reportPanic writes a handler panic recovered while dispatching on channel,
+// with its stack and the metadata of the handler's subscription, to the
+// WithErrorWriter sink, or to stdout without one.
+func (c *Client) reportPanic(channel string, metadata map[string]string, r interface{}) {
+	w := c.errorWriter
+	if w == nil {
+		w = os.Stdout
+	}
+	c.writeErrorLine(w, channel, metadata, "panic", fmt.Sprintf("%+v\n%s", r, debug.Stack()))
+}
+
+// guardLoop runs fn, a step of the connect loop, turning a panic in it into
+// a *LoopPanicError after writing it out like a handler panic.
+func (c *Client) guardLoop(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.reportPanic("/meta/connect", nil, r)
+			err = &LoopPanicError{Value: r}
+		}
+	}()
+	return fn()
+}
+
+// writeErrorLine writes a timestamped line about a failure on channel to w,
+// preceded by the summary of the similar lines WithErrorLogRate suppressed,
+// if any. Both are written under errorWriterMu, so that concurrent reports
+// never interleave.
+func (c *Client) writeErrorLine(w io.Writer, channel string, metadata map[string]string, kind, text string) {
+	var labels strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(metadata)) {
+		fmt.Fprintf(&labels, " %s=%s", k, metadata[k])
+	}
+	c.errorWriterMu.Lock()
+	defer c.errorWriterMu.Unlock()
+	now := time.Now()
+	if c.errorLog != nil {
+		first, _, _ := strings.Cut(text, "\n")
+		ok, suppressed := c.errorLog.allow(kind+" "+channel+labels.String()+": "+first, now)
+		if suppressed > 0 {
+			fmt.Fprintf(w, "%s %s channel=%s%s: %d similar %ss suppressed\n", now.UTC().Format(time.RFC3339Nano), kind, channel, labels.String(), suppressed, kind)
+		}
+		if !ok {
+			return
+		}
+	}
+	fmt.Fprintf(w, "%s %s channel=%s%s: %s\n", now.UTC().Format(time.RFC3339Nano), kind, channel, labels.String(), text)
+}
+
+// maxErrorLogKeys bounds how many distinct failures an errorLogLimiter
+// tracks before it forgets the ones whose window has ended.
+const maxErrorLogKeys = 1024
+
+// errorLogLimiter lets through at most n lines per window of the same failure,
+// counting the rest so they can be summarized once the next window starts.
+type errorLogLimiter struct {
+	n   int
+	per time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*errorLogWindow
+}
+
+type errorLogWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// allow reports whether a line for key may be written at now, and how many
+// lines for key a previous window suppressed, to be reported first.
+func (l *errorLogLimiter) allow(key string, now time.Time) (ok bool, suppressed int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	win := l.windows[key]
+	if win == nil {
+		if len(l.windows) >= maxErrorLogKeys {
+			for k, w := range l.windows {
+				if now.Sub(w.start) >= l.per && w.suppressed == 0 {
+					delete(l.windows, k)
+				}
+			}
+		}
+		win = &errorLogWindow{start: now}
+		l.windows[key] = win
+	}
+	if now.Sub(win.start) >= l.per {
+		suppressed = win.suppressed
+		*win = errorLogWindow{start: now}
+	}
+	if win.count >= l.n {
+		win.suppressed++
+		return false, 0
+	}
+	win.count++
+	return true, suppressed
+}
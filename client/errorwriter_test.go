@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestErrorWriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	out := &syncBuffer{}
+	c := NewClient(server.URL, WithErrorWriter(out), WithStopOnConnectError(true))
+	c.clientID = "test-client-id"
+
+	c.handlers["/foo"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) { panic("boom") }}}
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		got := out.String()
+		if strings.Contains(got, "panic channel=/foo: boom") && strings.Contains(got, "error channel=/meta/connect:") {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	got := out.String()
+	if !strings.Contains(got, "panic channel=/foo: boom\n") || !strings.Contains(got, "goroutine ") {
+		t.Errorf("Expected the handler panic with its stack, got %q", got)
+	}
+	if !strings.Contains(got, "error channel=/meta/connect: unexpected HTTP status 503") {
+		t.Errorf("Expected the connect error, got %q", got)
+	}
+	if !strings.HasSuffix(got, "\n") {
+		t.Errorf("Expected newline-terminated lines, got %q", got)
+	}
+}
+
+func TestLoopPanicGuard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/connect","successful":true}]`))
+	}))
+	defer server.Close()
+
+	panicky := OnIncoming(func(msg *message.BayeuxMessage) { panic("boom") })
+	out := &syncBuffer{}
+	c := NewClient(server.URL, panicky, WithErrorWriter(out))
+	c.clientID = "test-client-id"
+	err := c.ServeContext(context.Background())
+	var panicErr *LoopPanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" {
+		t.Errorf("Expected the loop to stop with the panic, got %v", err)
+	}
+	if !strings.Contains(out.String(), "panic channel=/meta/connect: boom") {
+		t.Errorf("Expected the panic to be written out, got %q", out.String())
+	}
+
+	var once sync.Once
+	recovered := make(chan struct{})
+	c = NewClient(server.URL, WithRestartOnLoopPanic(true), WithErrorWriter(&syncBuffer{}), OnIncoming(func(msg *message.BayeuxMessage) {
+		once.Do(func() { panic("boom") })
+		select {
+		case <-recovered:
+		default:
+			close(recovered)
+		}
+	}))
+	c.clientID = "test-client-id"
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.stopLoop()
+	select {
+	case <-recovered:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected the loop to keep polling after the panic")
+	}
+}
+
+type flushingBuffer struct {
+	syncBuffer
+	flushed int
+}
+
+func (b *flushingBuffer) Flush() error {
+	b.flushed++
+	return nil
+}
+
+func TestDisconnectFlushesSinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/disconnect","successful":true}]`))
+	}))
+	defer server.Close()
+
+	out := &flushingBuffer{}
+	c := NewClient(server.URL, WithErrorWriter(out))
+	c.clientID = "test-client-id"
+	if err := c.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+	if out.flushed != 1 {
+		t.Errorf("Expected the error writer to be flushed once, got %d", out.flushed)
+	}
+}
+
+func TestFlushErrorWriterWhileReporting(t *testing.T) {
+	var out bytes.Buffer
+	buffered := bufio.NewWriter(&out)
+	c := NewClient("http://unused.invalid", WithErrorWriter(buffered))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.reportPanic("/foo", nil, "boom")
+		}()
+		go func() {
+			defer wg.Done()
+			c.flushSinks()
+		}()
+	}
+	wg.Wait()
+	c.flushSinks()
+
+	if n := strings.Count(out.String(), "panic channel=/foo: boom\n"); n != 10 {
+		t.Errorf("Expected 10 whole panic lines after the flushes, got %d", n)
+	}
+}
+
+func TestErrorWriterSerializesReports(t *testing.T) {
+	var out bytes.Buffer
+	c := NewClient("http://unused.invalid", WithErrorWriter(&out))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.reportPanic("/foo", nil, "boom")
+			c.reportError("/meta/connect", errors.New("unavailable"))
+		}()
+	}
+	wg.Wait()
+
+	got := out.String()
+	if n := strings.Count(got, "panic channel=/foo: boom\n"); n != 20 {
+		t.Errorf("Expected 20 whole panic lines, got %d", n)
+	}
+	if n := strings.Count(got, "error channel=/meta/connect: unavailable\n"); n != 20 {
+		t.Errorf("Expected 20 whole error lines, got %d", n)
+	}
+}
+
+func TestErrorLogRate(t *testing.T) {
+	var out bytes.Buffer
+	c := NewClient("http://unused.invalid", WithErrorWriter(&out), WithErrorLogRate(2, 50*time.Millisecond))
+
+	for i := 0; i < 10; i++ {
+		c.reportPanic("/foo", nil, "boom")
+	}
+	c.reportPanic("/bar", nil, "boom")
+	if got := strings.Count(out.String(), "panic channel=/foo: boom\n"); got != 2 {
+		t.Errorf("Expected 2 panic lines for /foo within the window, got %d", got)
+	}
+	if !strings.Contains(out.String(), "panic channel=/bar: boom\n") {
+		t.Errorf("Expected a different failure to be logged on its own")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	c.reportPanic("/foo", nil, "boom")
+	got := out.String()
+	if !strings.Contains(got, "panic channel=/foo: 8 similar panics suppressed\n") {
+		t.Errorf("Expected the suppressed panics to be summarized, got %q", got)
+	}
+	if n := strings.Count(got, "panic channel=/foo: boom\n"); n != 3 {
+		t.Errorf("Expected the next window to log again, got %d lines", n)
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// Extension hooks into every message the client sends and receives, meta
+// messages included, and may modify it. An extension that returns an error
+// or panics leaves the message as it was: the failure goes to the
+// WithExtensionErrorHandler callback and, under WithAbortOnExtensionError, an
+// outgoing failure aborts the send.
+type Extension interface {
+	Outgoing(msg *message.BayeuxMessage) error
+	Incoming(msg *message.BayeuxMessage) error
+}
+
+// ExtensionError reports an extension that failed on an outgoing message
+// while WithAbortOnExtensionError is set. Failure is the error the extension
+// returned or the value it panicked with.
+type ExtensionError struct {
+	Extension Extension
+	Failure   interface{}
+}
+
+func (e *ExtensionError) Error() string {
+	return fmt.Sprintf("extension %T failed: %v", e.Extension, e.Failure)
+}
+
+// Unwrap returns the extension's error, if it returned one rather than
+// panicking.
+func (e *ExtensionError) Unwrap() error {
+	err, _ := e.Failure.(error)
+	return err
+}
+
+// runExtension applies fn, one side of ext, to a copy of msg and copies the
+// result back only if it succeeded, so a failing extension cannot leave a
+// half-modified message behind. Failures are passed to the extension error
+// handler and returned.
+func (c *Client) runExtension(ext Extension, msg *message.BayeuxMessage, fn func(*message.BayeuxMessage) error) (failure interface{}) {
+	clone := cloneMessage(msg)
+	defer func() {
+		if r := recover(); r != nil {
+			failure = r
+		}
+		if failure != nil {
+			if c.extensionErrorHandler != nil {
+				c.extensionErrorHandler(ext, failure)
+			}
+			return
+		}
+		*msg = *clone
+	}()
+	if err := fn(clone); err != nil {
+		return err
+	}
+	return nil
+}
+
+// prepareOutgoing stamps every message of a request batch that has no id yet
+// with a new one, then runs it through the extensions and the OnOutgoing
+// hook, just before the batch is encoded.
+func (c *Client) prepareOutgoing(msgs ...*message.BayeuxMessage) error {
+	for _, msg := range msgs {
+		if msg.ID == "" {
+			msg.ID = c.newMessageID()
+		}
+	}
+	if err := c.applyOutgoing(msgs...); err != nil {
+		return err
+	}
+	c.observeOutgoing(msgs...)
+	return nil
+}
+
+// applyOutgoing runs messages through the outgoing side of the extensions.
+func (c *Client) applyOutgoing(msgs ...*message.BayeuxMessage) error {
+	for _, msg := range msgs {
+		for _, ext := range c.extensions {
+			if failure := c.runExtension(ext, msg, ext.Outgoing); failure != nil && c.abortOnExtensionError {
+				return &ExtensionError{Extension: ext, Failure: failure}
+			}
+		}
+	}
+	return nil
+}
+
+// applyIncoming runs a received message through the extensions. A failing
+// extension never drops the message; it continues unmodified.
+func (c *Client) applyIncoming(msg *message.BayeuxMessage) {
+	for _, ext := range c.extensions {
+		c.runExtension(ext, msg, ext.Incoming)
+	}
+}
+
+// outgoingExt returns the ext object to send with a message, ext extended
+// with the send time in milliseconds under WithClientTimestamp. ext itself is
+// left untouched.
+func (c *Client) outgoingExt(ext map[string]interface{}) map[string]interface{} {
+	if c.timestampField == "" {
+		return ext
+	}
+	stamped := make(map[string]interface{}, len(ext)+1)
+	for k, v := range ext {
+		stamped[k] = v
+	}
+	stamped[c.timestampField] = time.Now().UnixMilli()
+	return stamped
+}
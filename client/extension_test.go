@@ -0,0 +1,141 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+type funcExtension struct {
+	outgoing func(*message.BayeuxMessage) error
+	incoming func(*message.BayeuxMessage) error
+}
+
+func (e funcExtension) Outgoing(msg *message.BayeuxMessage) error { return e.outgoing(msg) }
+func (e funcExtension) Incoming(msg *message.BayeuxMessage) error { return e.incoming(msg) }
+
+func TestExtensionFailuresAreIsolated(t *testing.T) {
+	var sent []message.BayeuxMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/foo","successful":true}]`))
+	}))
+	defer server.Close()
+
+	tag := funcExtension{
+		outgoing: func(msg *message.BayeuxMessage) error { msg.ID = "tagged"; return nil },
+		incoming: func(msg *message.BayeuxMessage) error { return nil },
+	}
+	buggy := funcExtension{
+		outgoing: func(msg *message.BayeuxMessage) error {
+			msg.Data["broken"] = true
+			panic("boom")
+		},
+		incoming: func(msg *message.BayeuxMessage) error { return errors.New("bad ack") },
+	}
+	var failures []interface{}
+	c := NewClient(server.URL, WithExtension(tag), WithExtension(buggy), WithExtensionErrorHandler(func(ext Extension, failure interface{}) {
+		failures = append(failures, failure)
+	}))
+	c.clientID = "test-client-id"
+
+	if err := c.Publish("/foo", map[string]interface{}{"n": 1}); err != nil {
+		t.Fatalf("Expected the publish to survive the extension, got %v", err)
+	}
+	if sent[0].ID != "tagged" || sent[0].Data["broken"] != nil {
+		t.Errorf("Expected only the working extension's changes to be sent, got %+v", sent[0])
+	}
+	if len(failures) != 2 || failures[0] != "boom" {
+		t.Errorf("Expected the panic and the incoming error to be reported, got %v", failures)
+	}
+
+	c.abortOnExtensionError = true
+	var extErr *ExtensionError
+	if err := c.Publish("/foo", map[string]interface{}{"n": 2}); !errors.As(err, &extErr) || extErr.Failure != "boom" {
+		t.Errorf("Expected the send to be aborted with an ExtensionError, got %v", err)
+	}
+}
+
+func TestClientTimestamp(t *testing.T) {
+	var exts []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []struct {
+			Channel string                 `json:"channel"`
+			Ext     map[string]interface{} `json:"ext"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		exts = append(exts, reqMsgs[0].Ext)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: reqMsgs[0].Channel, ClientID: "test-client-id", Successful: boolPtr(true)}})
+	}))
+	defer server.Close()
+
+	before := time.Now().UnixMilli()
+	c := NewClient(server.URL, WithClientTimestamp(true))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if err := c.PublishIfMatch("/foo", map[string]interface{}{"n": 1}, "v1"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	for i, ext := range exts {
+		ts, _ := ext["clientTimestamp"].(float64)
+		if int64(ts) < before || int64(ts) > time.Now().UnixMilli() {
+			t.Errorf("Expected request %d to carry the send time, got %v", i, ext)
+		}
+	}
+	if exts[1]["ifMatch"] != "v1" {
+		t.Errorf("Expected the timestamp to be added to the existing ext, got %v", exts[1])
+	}
+}
+
+func TestHandshakeExtFunc(t *testing.T) {
+	var tokens []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []struct {
+			Channel string                 `json:"channel"`
+			Ext     map[string]interface{} `json:"ext"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		tokens = append(tokens, reqMsgs[0].Ext["token"])
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: reqMsgs[0].Channel, ClientID: "test-client-id", Successful: boolPtr(true)}})
+	}))
+	defer server.Close()
+
+	var order []string
+	minted := 0
+	ext := funcExtension{
+		outgoing: func(msg *message.BayeuxMessage) error {
+			order = append(order, "extension")
+			return nil
+		},
+		incoming: func(msg *message.BayeuxMessage) error { return nil },
+	}
+	c := NewClient(server.URL, WithExtension(ext), WithHandshakeExtFunc(func() map[string]interface{} {
+		minted++
+		order = append(order, "ext")
+		return map[string]interface{}{"token": fmt.Sprintf("t%d", minted)}
+	}))
+	for i := 0; i < 2; i++ {
+		if err := c.Handshake(); err != nil {
+			t.Fatalf("Handshake failed: %v", err)
+		}
+	}
+
+	if !reflect.DeepEqual(tokens, []interface{}{"t1", "t2"}) {
+		t.Errorf("Expected a fresh token at each handshake, got %v", tokens)
+	}
+	if len(order) < 2 || order[0] != "ext" || order[1] != "extension" {
+		t.Errorf("Expected the ext func to run before the extensions, got %v", order)
+	}
+}
@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// defaultFailoverThreshold is how many consecutive connect failures against
+// one server WithServerURLs tolerates before moving on to the next.
+const defaultFailoverThreshold = 3
+
+// abandonedSessionTimeout bounds the /meta/disconnect sent to a server whose
+// handshake lost a WithFastestServer race but still opened a session.
+const abandonedSessionTimeout = 5 * time.Second
+
+// ServerURL returns the URL of the server the client currently talks to,
+// which changes as WithServerURLs fails over.
+func (c *Client) ServerURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.serverURL
+}
+
+// countConnectFailure records a failed poll against the current server. Once
+// WithServerURLs has seen the failover threshold of them in a row, it moves
+// to the next server in the list, round-robin, and reports true.
+func (c *Client) countConnectFailure() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.serverURLs) < 2 {
+		return false
+	}
+	c.connectFailures++
+	if c.connectFailures < c.failoverThreshold {
+		return false
+	}
+	c.connectFailures = 0
+	c.serverIndex = (c.serverIndex + 1) % len(c.serverURLs)
+	c.serverURL = c.serverURLs[c.serverIndex]
+	return true
+}
+
+// resetConnectFailures clears the failure count after a successful poll.
+func (c *Client) resetConnectFailures() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connectFailures = 0
+}
+
+// resubscribeRetryInterval is how often a failed resubscribe is retried
+// within the WithResubscribeGrace period.
+const resubscribeRetryInterval = time.Second
+
+// resubscribe subscribes the current session to every channel in the
+// subscription store that still has handlers, after a fresh handshake gave
+// the client a session the server knows no subscriptions of. It does nothing
+// under WithAutoResubscribe(false). The returned error joins the per-channel
+// failures, whose channels are handed to orphaned.
+func (c *Client) resubscribe(ctx context.Context) error {
+	c.mu.Lock()
+	c.resubscribePending = false
+	c.mu.Unlock()
+	if !c.autoResubscribe {
+		return nil
+	}
+	var errs []error
+	for _, channel := range c.activeChannels() {
+		if err := c.sendSubscribe(ctx, channel); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel, err))
+			c.orphaned(ctx, channel, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// orphaned reports channel, whose resubscribe failed with err, to the
+// OnOrphanedSubscription hook. Under WithResubscribeGrace the resubscribe is
+// retried in the background first, and the hook only fires if none succeeded
+// by the end of the grace period. Retrying stops when ctx is done or the
+// channel loses its last handler.
+func (c *Client) orphaned(ctx context.Context, channel string, err error) {
+	if c.onOrphanedSubscription == nil {
+		return
+	}
+	if c.resubscribeGrace <= 0 {
+		c.onOrphanedSubscription(channel, err)
+		return
+	}
+	go func() {
+		deadline := time.Now().Add(c.resubscribeGrace)
+		for {
+			wait := min(resubscribeRetryInterval, time.Until(deadline))
+			if wait <= 0 {
+				c.onOrphanedSubscription(channel, err)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			if !c.hasHandlers(channel) {
+				return
+			}
+			if err = c.sendSubscribe(ctx, channel); err == nil {
+				return
+			}
+		}
+	}()
+}
+
+// activeChannels returns the channels of the subscription store that have
+// handlers registered, taken under handlersMu so that a concurrent Subscribe
+// or Unsubscribe is either wholly in the snapshot or wholly out of it.
+func (c *Client) activeChannels() []string {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+	var channels []string
+	for _, channel := range c.store.List() {
+		if len(c.handlers[channel]) > 0 {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// hasHandlers reports whether channel still has handlers registered.
+func (c *Client) hasHandlers(channel string) bool {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+	return len(c.handlers[channel]) > 0
+}
+
+// handshakeResult is the outcome of one handshake of a WithFastestServer race.
+type handshakeResult struct {
+	index int
+	ack   *message.BayeuxMessage
+	err   error
+}
+
+// raceHandshakes sends the handshake reqBody to every WithServerURLs server at
+// once and starts the session on the first one to accept it, cancelling the
+// others. Losers that opened a session anyway are disconnected in the
+// background. The returned error joins the per-server failures when none
+// succeeded.
+func (c *Client) raceHandshakes(ctx context.Context, reqBody []byte) error {
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan handshakeResult, len(c.serverURLs))
+	for i, url := range c.serverURLs {
+		go func(i int, url string) {
+			ack, err := c.handshakeAt(ctx, url, reqBody)
+			results <- handshakeResult{index: i, ack: ack, err: err}
+		}(i, url)
+	}
+
+	var errs []error
+	for pending := len(c.serverURLs); pending > 0; pending-- {
+		r := <-results
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.serverURLs[r.index], r.err))
+			continue
+		}
+		cancel()
+		go c.abandonHandshakes(results, pending-1)
+
+		c.mu.Lock()
+		c.serverIndex = r.index
+		c.serverURL = c.serverURLs[r.index]
+		c.connectFailures = 0
+		c.mu.Unlock()
+		c.acceptHandshake(r.ack)
+		return nil
+	}
+	cancel()
+	return errors.Join(errs...)
+}
+
+// abandonHandshakes waits for the remaining n results of a handshake race and
+// disconnects the sessions the losers opened.
+func (c *Client) abandonHandshakes(results <-chan handshakeResult, n int) {
+	for ; n > 0; n-- {
+		r := <-results
+		if r.err != nil {
+			continue
+		}
+		reqBody, err := json.Marshal([]extMessage{{BayeuxMessage: message.BayeuxMessage{
+			Channel:  "/meta/disconnect",
+			ClientID: r.ack.ClientID,
+		}}})
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), abandonedSessionTimeout)
+		if resp, err := c.doRequest(ctx, c.serverURLs[r.index], reqBody); err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestServerURLsFailover(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		if reqMsgs[0].Channel == "/meta/connect" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: reqMsgs[0].Channel, ClientID: "primary", Successful: boolPtr(true)}})
+	}))
+	defer primary.Close()
+
+	var mu sync.Mutex
+	var resubscribed []string
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		if reqMsgs[0].Channel == "/meta/subscribe" {
+			mu.Lock()
+			resubscribed = append(resubscribed, reqMsgs[0].Subscription)
+			mu.Unlock()
+		}
+		if reqMsgs[0].Channel == "/meta/connect" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: reqMsgs[0].Channel, ClientID: "backup", Successful: boolPtr(true)}})
+	}))
+	defer backup.Close()
+
+	c := NewClient("http://unused.invalid", WithServerURLs([]string{primary.URL, backup.URL}), WithFailoverThreshold(1))
+	if c.ServerURL() != primary.URL {
+		t.Fatalf("Expected the first URL to be active, got %s", c.ServerURL())
+	}
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Disconnect()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for c.getClientID() != "backup" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if c.ServerURL() != backup.URL || c.getClientID() != "backup" {
+		t.Fatalf("Expected a failover to the backup, got %s with session %q", c.ServerURL(), c.getClientID())
+	}
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(resubscribed) != 1 || resubscribed[0] != "/foo" {
+		t.Errorf("Expected /foo to be resubscribed on the backup, got %v", resubscribed)
+	}
+}
+
+func TestFastestServer(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+			return
+		case <-time.After(2 * time.Second):
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: "/meta/handshake", ClientID: "slow", Successful: boolPtr(true)}})
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: "/meta/handshake", ClientID: "fast", Successful: boolPtr(true)}})
+	}))
+	defer fast.Close()
+
+	c := NewClient("http://unused.invalid", WithServerURLs([]string{slow.URL, fast.URL}), WithFastestServer(true))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if c.ServerURL() != fast.URL || c.getClientID() != "fast" {
+		t.Errorf("Expected the fast server to win, got %s with session %q", c.ServerURL(), c.getClientID())
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the losing handshake to be cancelled")
+	}
+	if got := c.Stats().Handshakes; got != 1 {
+		t.Errorf("Expected a single counted handshake, got %d", got)
+	}
+}
+
+func TestResubscribeGrace(t *testing.T) {
+	var mu sync.Mutex
+	failures := map[string]int{"/flaky": 1, "/dead": 1 << 30}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		mu.Lock()
+		ok := failures[reqMsgs[0].Subscription] == 0
+		if !ok {
+			failures[reqMsgs[0].Subscription]--
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: "/meta/subscribe", Successful: boolPtr(ok)}})
+	}))
+	defer server.Close()
+
+	orphans := make(chan string, 2)
+	c := NewClient(server.URL, WithResubscribeGrace(100*time.Millisecond), OnOrphanedSubscription(func(channel string, err error) {
+		orphans <- channel
+	}))
+	c.clientID = "test-client-id"
+	for _, channel := range []string{"/flaky", "/dead"} {
+		c.handlers[channel] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) {}}}
+		c.store.Add(channel)
+	}
+
+	if err := c.resubscribe(context.Background()); err == nil {
+		t.Fatalf("Expected the first resubscribe attempts to fail")
+	}
+	select {
+	case channel := <-orphans:
+		if channel != "/dead" {
+			t.Errorf("Expected only /dead to be orphaned, got %s", channel)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected /dead to be reported once the grace period ended")
+	}
+	select {
+	case channel := <-orphans:
+		t.Errorf("Expected /flaky to recover within the grace period, got %s orphaned", channel)
+	case <-time.After(150 * time.Millisecond):
+	}
+}
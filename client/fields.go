@@ -0,0 +1,122 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// DataInt64 returns msg.Data[key] as an int64. It accepts json.Number values
+// produced under WithUseNumber as well as integral float64 values; the latter
+// may already have lost precision above 2^53.
+func DataInt64(msg *message.BayeuxMessage, key string) (int64, error) {
+	v, ok := msg.Data[key]
+	if !ok {
+		return 0, fmt.Errorf("Error reading data field %q: missing", key)
+	}
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("Error reading data field %q: %w", key, err)
+		}
+		return i, nil
+	case float64:
+		if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+			return 0, fmt.Errorf("Error reading data field %q: %v is not an int64", key, n)
+		}
+		return int64(n), nil
+	case int:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	default:
+		return 0, fmt.Errorf("Error reading data field %q: unexpected type %T", key, v)
+	}
+}
+
+// DataFloat64 returns msg.Data[key] as a float64, whether it was decoded as a
+// float64 or as a json.Number.
+func DataFloat64(msg *message.BayeuxMessage, key string) (float64, error) {
+	v, ok := msg.Data[key]
+	if !ok {
+		return 0, fmt.Errorf("Error reading data field %q: missing", key)
+	}
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("Error reading data field %q: %w", key, err)
+		}
+		return f, nil
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	default:
+		return 0, fmt.Errorf("Error reading data field %q: unexpected type %T", key, v)
+	}
+}
+
+// DataAs decodes msg.Data into a new T, through its JSON encoding, so that
+// struct tags and custom unmarshalers apply.
+func DataAs[T any](msg *message.BayeuxMessage) (*T, error) {
+	raw, err := json.Marshal(msg.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading data of %s: %w", msg.Channel, err)
+	}
+	v := new(T)
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, fmt.Errorf("Error reading data of %s: %w", msg.Channel, err)
+	}
+	return v, nil
+}
+
+// SubscribeTyped subscribes to channel and hands each message's Data,
+// decoded into a T by DataAs, to handler. Messages whose data does not decode
+// are not delivered; their error goes to WithErrorHandler and WithErrorWriter
+// like a connect loop error.
+func SubscribeTyped[T any](c *Client, channel string, handler func(*T)) (Subscription, error) {
+	return c.Subscribe(channel, func(msg *message.BayeuxMessage) {
+		v, err := DataAs[T](msg)
+		if err != nil {
+			c.reportError(msg.Channel, err)
+			return
+		}
+		handler(v)
+	})
+}
+
+// cloneMessage returns a copy of msg whose Data shares nothing with the
+// original, so one handler modifying its message cannot affect another's.
+func cloneMessage(msg *message.BayeuxMessage) *message.BayeuxMessage {
+	clone := *msg
+	if msg.Data != nil {
+		clone.Data = cloneValue(msg.Data).(map[string]interface{})
+	}
+	return &clone
+}
+
+// cloneValue deep-copies the maps and slices of a decoded JSON value.
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = cloneValue(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = cloneValue(e)
+		}
+		return s
+	default:
+		return v
+	}
+}
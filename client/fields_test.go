@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestUseNumberPreservesPrecision(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/connect","successful":true},{"channel":"/foo","data":{"id":9007199254740993,"ratio":0.5}}]`))
+	}))
+	defer server.Close()
+
+	for _, useNumber := range []bool{false, true} {
+		c := NewClient(server.URL, WithUseNumber(useNumber))
+		c.clientID = "test-client-id"
+
+		received := make(chan *message.BayeuxMessage, 1)
+		c.handlers["/foo"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) { received <- msg }}}
+		if err := c.connectOnce(context.Background()); err != nil {
+			t.Fatalf("connectOnce failed: %v", err)
+		}
+
+		var msg *message.BayeuxMessage
+		select {
+		case msg = <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("Message not received")
+		}
+
+		id, err := DataInt64(msg, "id")
+		if err != nil {
+			t.Fatalf("DataInt64 failed: %v", err)
+		}
+		if exact := id == 9007199254740993; exact != useNumber {
+			t.Errorf("UseNumber %v: unexpected id %d", useNumber, id)
+		}
+		if ratio, err := DataFloat64(msg, "ratio"); err != nil || ratio != 0.5 {
+			t.Errorf("UseNumber %v: expected ratio 0.5, got %v (%v)", useNumber, ratio, err)
+		}
+	}
+}
+
+func TestDataInt64Errors(t *testing.T) {
+	msg := &message.BayeuxMessage{Data: map[string]interface{}{"frac": 1.5, "name": "x"}}
+	for _, key := range []string{"missing", "frac", "name"} {
+		if _, err := DataInt64(msg, key); err == nil {
+			t.Errorf("Expected DataInt64 to fail for %q", key)
+		}
+	}
+}
+
+func TestSubscribeTyped(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/subscribe","successful":true}]`))
+	}))
+	defer server.Close()
+
+	type order struct {
+		ID    string  `json:"id"`
+		Total float64 `json:"total"`
+	}
+	errs := make(chan error, 1)
+	c := NewClient(server.URL, WithErrorHandler(func(err error) { errs <- err }))
+	c.clientID = "test-client-id"
+
+	got := make(chan *order, 1)
+	if _, err := SubscribeTyped(c, "/orders", func(o *order) { got <- o }); err != nil {
+		t.Fatalf("SubscribeTyped failed: %v", err)
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/orders", Data: map[string]interface{}{"id": "a1", "total": 12.5}})
+	if o := <-got; o.ID != "a1" || o.Total != 12.5 {
+		t.Errorf("Expected order a1 of 12.5, got %+v", o)
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/orders", Data: map[string]interface{}{"total": "twelve"}})
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "/orders") {
+			t.Errorf("Expected the decode error to name the channel, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the decode failure to reach the error handler")
+	}
+}
@@ -0,0 +1,34 @@
+package client
+
+import "errors"
+
+// Flusher is implemented by sinks that buffer their output, such as a
+// bufio.Writer given to WithErrorWriter or a batching Tracer. The client
+// flushes them on Disconnect and Shutdown so that the last errors, heartbeats
+// and spans are not lost when the process exits. The error writer is flushed
+// under the same lock as its writes, so a bufio.Writer is safe there.
+type Flusher interface {
+	Flush() error
+}
+
+// flushSinks flushes every configured sink that implements Flusher, after
+// the final disconnect so that its outcome is included.
+func (c *Client) flushSinks() error {
+	var errs []error
+	if f, ok := c.errorWriter.(Flusher); ok {
+		c.errorWriterMu.Lock()
+		err := f.Flush()
+		c.errorWriterMu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, sink := range []interface{}{c.livenessWriter, c.tracer} {
+		if f, ok := sink.(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
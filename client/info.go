@@ -0,0 +1,58 @@
+package client
+
+import "github.com/charlinchui/galliard/message"
+
+// String returns the state's name as reported by Info.
+func (s loopState) String() string {
+	switch s {
+	case loopRunning:
+		return "running"
+	case loopStopping:
+		return "stopping"
+	case loopPolling:
+		return "polling"
+	}
+	return "idle"
+}
+
+// ClientInfo is a snapshot of the client's session and configuration, for
+// dashboards and debug endpoints.
+type ClientInfo struct {
+	// ClientID is the session id, empty before the first handshake.
+	ClientID string
+	// State is the connect loop's state: "idle", "running", "stopping" or
+	// "polling" during a PollOnce call.
+	State string
+	// ActiveTransport is the connection type the client polls with.
+	ActiveTransport string
+	// ServerURL is the server currently in use.
+	ServerURL string
+	// LastAdvice is a copy of the most recent advice from the server, or nil.
+	LastAdvice *message.Advice
+	// SubscribedChannels lists the desired subscriptions, in sorted order.
+	SubscribedChannels []string
+	// Stats holds the client's counters.
+	Stats Stats
+}
+
+// Info returns a snapshot of the client's state. The session fields are read
+// under a single lock so they are consistent with each other; the channels
+// and counters are read right after, each consistent on its own.
+func (c *Client) Info() ClientInfo {
+	c.mu.Lock()
+	info := ClientInfo{
+		ClientID:        c.clientID,
+		State:           c.state.String(),
+		ActiveTransport: supportedConnectionTypes[0],
+		ServerURL:       c.serverURL,
+	}
+	if c.advice != nil {
+		advice := *c.advice
+		info.LastAdvice = &advice
+	}
+	c.mu.Unlock()
+
+	info.SubscribedChannels = c.store.List()
+	info.Stats = c.Stats()
+	return info
+}
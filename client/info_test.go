@@ -0,0 +1,35 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestInfo(t *testing.T) {
+	c := NewClient("http://example.com/bayeux")
+	c.clientID = "test-client-id"
+	c.advice = &message.Advice{Reconnect: "retry", Interval: 100}
+	c.store.Add("/foo")
+	c.updateStats(func(s *Stats) { s.Publishes = 2 })
+
+	info := c.Info()
+	want := ClientInfo{
+		ClientID:           "test-client-id",
+		State:              "idle",
+		ActiveTransport:    "long-polling",
+		ServerURL:          "http://example.com/bayeux",
+		LastAdvice:         &message.Advice{Reconnect: "retry", Interval: 100},
+		SubscribedChannels: []string{"/foo"},
+		Stats:              Stats{Publishes: 2},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("Expected %+v, got %+v", want, info)
+	}
+
+	info.LastAdvice.Interval = 0
+	if c.advice.Interval != 100 {
+		t.Errorf("Expected the snapshot's advice to be a copy")
+	}
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// liveness writes a heartbeat line every livenessInterval until the connect
+// loop closes stopped. It runs apart from the loop, so a wedged loop still
+// ticks and shows up as a growing lastMessageAge.
+func (c *Client) liveness(stopped chan struct{}) {
+	ticker := time.NewTicker(c.livenessInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			clientID, last := c.clientID, c.lastMessageAt
+			c.mu.Unlock()
+
+			age := "never"
+			if !last.IsZero() {
+				age = now.Sub(last).Round(time.Millisecond).String()
+			}
+			fmt.Fprintf(c.livenessWriter, "%s heartbeat clientId=%s lastMessageAge=%s\n",
+				now.UTC().Format(time.RFC3339Nano), clientID, age)
+		}
+	}
+}
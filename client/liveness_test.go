@@ -0,0 +1,66 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLivenessTicker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		resp := []message.BayeuxMessage{{Channel: "/meta/connect", Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	var out syncBuffer
+	c := NewClient(server.URL, WithLivenessTicker(10*time.Millisecond, &out))
+	c.clientID = "test-client-id"
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	time.Sleep(55 * time.Millisecond)
+	c.Disconnect()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected several heartbeat lines, got %q", out.String())
+	}
+	if !strings.Contains(lines[0], "heartbeat clientId=test-client-id lastMessageAge=") {
+		t.Errorf("Unexpected heartbeat line %q", lines[0])
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	stopped := out.String()
+	time.Sleep(30 * time.Millisecond)
+	if out.String() != stopped {
+		t.Errorf("Expected the ticker to stop on Disconnect")
+	}
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// Messages subscribes to channel and returns a Go channel delivering its
+// messages in arrival order, as an alternative to a handler for use in a
+// select loop. Up to size messages are buffered, and size may only be zero
+// under Block. policy decides what happens to a message arriving while the
+// buffer is full: drops are counted in Stats as for WithChannelQueue, and
+// Block holds up dispatch, and with it the connect loop, until the receiver
+// catches up. The Go channel is closed when the handler feeding it goes,
+// whether through the returned Subscription, Client.Unsubscribe,
+// UnsubscribeAll, a Batch or Shutdown. Disconnect keeps it open, as it keeps
+// the handlers for the next Connect.
+func (c *Client) Messages(channel string, size int, policy OverflowPolicy) (<-chan *message.BayeuxMessage, Subscription, error) {
+	if size < 0 || (size == 0 && policy != Block) {
+		return nil, nil, fmt.Errorf("Error on the subscription request: invalid buffer size %d", size)
+	}
+	sink := &messageSink{c: c, ch: make(chan *message.BayeuxMessage, size), policy: policy, done: make(chan struct{})}
+	template := handlerEntry{direct: true, onRemove: sink.close}
+	sub, err := c.subscribeEntry(context.Background(), channel, nil, template, func(_ Subscription, msg *message.BayeuxMessage) {
+		sink.send(msg)
+	})
+	if err != nil {
+		sink.close()
+		return nil, nil, err
+	}
+	return sink.ch, sub, nil
+}
+
+// messageSink feeds the Go channel of Messages under its overflow policy.
+type messageSink struct {
+	c      *Client
+	ch     chan *message.BayeuxMessage
+	policy OverflowPolicy
+	done   chan struct{}
+	once   sync.Once
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// send delivers msg unless the sink is closed. A send held up by Block gives
+// up when the sink is closed.
+func (s *messageSink) send(msg *message.BayeuxMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.policy {
+	case Block:
+		select {
+		case s.ch <- msg:
+		case <-s.done:
+		}
+	case DropNewest:
+		select {
+		case s.ch <- msg:
+		default:
+			s.c.updateStats(func(st *Stats) { st.DroppedNewest++ })
+		}
+	default:
+		for {
+			select {
+			case s.ch <- msg:
+				return
+			default:
+			}
+			select {
+			case <-s.ch:
+				s.c.updateStats(func(st *Stats) { st.DroppedOldest++ })
+			default:
+			}
+		}
+	}
+}
+
+// close closes the Go channel once no send is in progress.
+func (s *messageSink) close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		close(s.ch)
+	})
+}
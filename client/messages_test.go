@@ -0,0 +1,103 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestMessages(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	msgs, sub, err := c.Messages("/events", 10, Block)
+	if err != nil {
+		t.Fatalf("Messages failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		c.dispatch(&message.BayeuxMessage{Channel: "/events", Data: map[string]interface{}{"n": float64(i)}})
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case msg := <-msgs:
+			if msg.Data["n"] != float64(i) {
+				t.Fatalf("Expected message %d in arrival order, got %v", i, msg.Data["n"])
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected message %d", i)
+		}
+	}
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	if _, ok := <-msgs; ok {
+		t.Errorf("Expected Unsubscribe to close the channel")
+	}
+	c.dispatch(&message.BayeuxMessage{Channel: "/events"})
+}
+
+func TestMessagesOverflow(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	oldest, _, _ := c.Messages("/oldest", 2, DropOldest)
+	newest, _, _ := c.Messages("/newest", 2, DropNewest)
+	for i := 0; i < 3; i++ {
+		for _, channel := range []string{"/oldest", "/newest"} {
+			c.dispatch(&message.BayeuxMessage{Channel: channel, Data: map[string]interface{}{"n": float64(i)}})
+		}
+	}
+
+	if first := <-oldest; first.Data["n"] != 1.0 {
+		t.Errorf("Expected DropOldest to discard message 0, got %v first", first.Data["n"])
+	}
+	if first := <-newest; first.Data["n"] != 0.0 {
+		t.Errorf("Expected DropNewest to keep message 0, got %v first", first.Data["n"])
+	}
+	if s := c.Stats(); s.DroppedOldest != 1 || s.DroppedNewest != 1 {
+		t.Errorf("Expected one drop of each kind, got %+v", s)
+	}
+
+	if _, _, err := c.Messages("/events", 0, DropNewest); err == nil {
+		t.Errorf("Expected an unbuffered channel to be rejected under DropNewest")
+	}
+}
+
+func TestMessagesClosedByUnsubscribeAll(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	all, _, err := c.Messages("/all", 1, Block)
+	if err != nil {
+		t.Fatalf("Messages failed: %v", err)
+	}
+	one, _, _ := c.Messages("/one", 1, Block)
+
+	if err := c.Unsubscribe("/one"); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	if err := c.UnsubscribeAll(); err != nil {
+		t.Fatalf("UnsubscribeAll failed: %v", err)
+	}
+	for name, ch := range map[string]<-chan *message.BayeuxMessage{"Unsubscribe": one, "UnsubscribeAll": all} {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Errorf("Expected %s to close the channel, got a message", name)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Expected %s to close the channel", name)
+		}
+	}
+}
@@ -0,0 +1,722 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+	"golang.org/x/time/rate"
+)
+
+// Option configures optional behavior of a Client at construction time.
+type Option func(*Client)
+
+// WithCorrelationField sets the field CallService uses to match replies to
+// requests. The default "id" matches on the message id; any other name is
+// written into the request's data and matched against the same key in the
+// reply's data, for servers that echo a custom field instead of the id.
+func WithCorrelationField(name string) Option {
+	return func(c *Client) {
+		c.correlationField = name
+	}
+}
+
+// WithAutoHandshake makes Subscribe and Publish perform the handshake
+// themselves when the client has no session yet. Concurrent callers share a
+// single handshake. By default the caller must call Handshake explicitly.
+func WithAutoHandshake(enabled bool) Option {
+	return func(c *Client) {
+		c.autoHandshake = enabled
+	}
+}
+
+// WithPublishRetry makes Publish retry transient failures (see IsTransient)
+// up to attempts more times, waiting backoff before the first retry and
+// doubling the wait after each one. A successful:false rejection from the
+// server is never retried.
+func WithPublishRetry(attempts int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.publishRetries = attempts
+		c.publishBackoff = backoff
+	}
+}
+
+// WithLivenessTicker writes a timestamped heartbeat line to w every interval
+// while the connect loop runs, so an external watchdog can detect a hung
+// client. Each line carries the age of the last server response, which keeps
+// growing if the loop is stuck even though the ticker is not. The ticker
+// stops on Disconnect.
+func WithLivenessTicker(interval time.Duration, w io.Writer) Option {
+	return func(c *Client) {
+		c.livenessInterval = interval
+		c.livenessWriter = w
+	}
+}
+
+// WithAdvertisedConnectionTypes overrides the connection types sent in the
+// handshake's supportedConnectionTypes, which defaults to ["long-polling"].
+// Only transports the client implements may be advertised; anything else
+// makes every request fail with a configuration error.
+func WithAdvertisedConnectionTypes(types []string) Option {
+	return func(c *Client) {
+		if len(types) == 0 {
+			c.optErr = errors.Join(c.optErr, errors.New("no connection types to advertise"))
+			return
+		}
+		for _, t := range types {
+			if !slices.Contains(supportedConnectionTypes, t) {
+				c.optErr = errors.Join(c.optErr, fmt.Errorf("unsupported connection type %q", t))
+				return
+			}
+		}
+		c.connectionTypes = types
+	}
+}
+
+// WithSubscriptionStore replaces the default MemorySubscriptionStore, for
+// callers that want to persist or filter the desired subscriptions.
+func WithSubscriptionStore(store SubscriptionStore) Option {
+	return func(c *Client) {
+		c.store = store
+	}
+}
+
+// WithErrorHandler registers a callback for errors the connect loop runs
+// into. It is called on the loop goroutine and must not block.
+func WithErrorHandler(handler func(error)) Option {
+	return func(c *Client) {
+		c.errorHandler = handler
+	}
+}
+
+// WithStopOnConnectError makes the connect loop stop at its first failed
+// poll instead of retrying, for short-lived consumers that prefer to fail
+// fast. The error is passed to the error handler and returned by
+// ServeContext.
+func WithStopOnConnectError(enabled bool) Option {
+	return func(c *Client) {
+		c.stopOnConnectError = enabled
+	}
+}
+
+// WithConnectTimeout sets the deadline of each /meta/connect long-poll
+// request. It takes precedence over the timeout the server advises at
+// handshake, which is otherwise used plus a margin for network delay.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.connectTimeout = d
+	}
+}
+
+// WithResponseUnwrapper installs a hook that rewrites every raw response
+// body before it is decoded, for servers that wrap the message array in an
+// envelope. The hook must return a JSON array of Bayeux messages.
+func WithResponseUnwrapper(unwrap func([]byte) ([]byte, error)) Option {
+	return func(c *Client) {
+		c.responseUnwrapper = unwrap
+	}
+}
+
+// WithStrictDecode rejects a response carrying a message field that is
+// neither in message.BayeuxMessage nor defined by the Bayeux specification,
+// with an error matching ErrUnknownField, to catch drift in the server's
+// schema. By default unknown fields are ignored.
+func WithStrictDecode(enabled bool) Option {
+	return func(c *Client) {
+		c.strictDecode = enabled
+	}
+}
+
+// WithUseNumber decodes numbers in responses as json.Number instead of
+// float64, so large integer ids in Data keep their precision. Use DataInt64
+// and DataFloat64 to read such fields.
+func WithUseNumber(enabled bool) Option {
+	return func(c *Client) {
+		c.useNumber = enabled
+	}
+}
+
+// WithHTTPClient sends every request through client instead of
+// http.DefaultClient, for custom transports, TLS settings such as client
+// certificates, or timeouts. A client Timeout must exceed the server's advised
+// timeout, since it also bounds the /meta/connect long poll. It cannot be
+// combined with the options that configure the client's own transport, such
+// as WithProxy or WithTLSHandshakeTimeout.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// WithProxy routes every request through the forward proxy at proxyURL.
+// Credentials in the URL's user info are sent as Proxy-Authorization.
+func WithProxy(proxyURL string) Option {
+	return func(c *Client) {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			c.optErr = errors.Join(c.optErr, fmt.Errorf("invalid proxy URL: %w", err))
+			return
+		}
+		c.ownTransport().Proxy = http.ProxyURL(u)
+	}
+}
+
+// WithProxyFunc sets the function that picks the proxy for each request, as
+// http.Transport.Proxy does. A nil URL means no proxy for that request.
+func WithProxyFunc(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *Client) {
+		c.ownTransport().Proxy = proxy
+	}
+}
+
+// WithTLSHandshakeTimeout bounds the TLS handshake of every new connection,
+// so a server that accepts the TCP connection but stalls fails fast instead
+// of at the overall request timeout.
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.ownTransport().TLSHandshakeTimeout = d
+	}
+}
+
+// WithResponseHeaderTimeout bounds the wait for the response headers once a
+// request has been written. It applies to the /meta/connect long poll too, so
+// d must exceed the server's advised timeout when the server holds polls open.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.ownTransport().ResponseHeaderTimeout = d
+	}
+}
+
+// WithPublishRateLimit caps outgoing publishes at rps per second. Publish,
+// CallService and batched publishes, one turn per message, wait for their
+// turn, and fail if their context expires while throttled.
+func WithPublishRateLimit(rps float64) Option {
+	return func(c *Client) {
+		c.publishLimiter = rate.NewLimiter(rate.Limit(rps), 1)
+	}
+}
+
+// WithRetryClassifier replaces the built-in decision of whether a failed
+// request is retried, stopped or repeated after a new handshake. It is
+// consulted by the connect loop and, when WithPublishRetry is set, by
+// Publish. By default the connect loop retries everything except a lost
+// session (rehandshake) or a reconnect:"none" advice, and Publish retries
+// only transient failures.
+func WithRetryClassifier(classify RetryClassifier) Option {
+	return func(c *Client) {
+		c.retryClassifier = classify
+	}
+}
+
+// WithOrderedHandlers runs the handlers of a channel one after another, in
+// registration order, for each message, instead of concurrently. A panicking
+// handler does not prevent the following ones from running. Messages
+// themselves are still dispatched independently of each other.
+func WithOrderedHandlers(enabled bool) Option {
+	return func(c *Client) {
+		c.orderedHandlers = enabled
+	}
+}
+
+// WithStartupBuffer holds back up to n data messages received before
+// ReleaseStartupBuffer is called, so messages arriving in the first connect
+// batches are not lost to handlers that are still being registered. Buffered
+// messages are replayed on ReleaseStartupBuffer, when the buffer fills up, or
+// at the latest a few seconds after the first one arrived.
+func WithStartupBuffer(n int) Option {
+	return func(c *Client) {
+		c.startupBufferSize = n
+	}
+}
+
+// WithIDGenerator replaces the incrementing counter that stamps the ids of
+// all outgoing messages, meta and published alike, for instance to embed a
+// trace id or use UUIDs. Service replies are correlated with whatever the
+// generator returns, so ids must be unique among the calls in flight. The
+// generator must not call back into the client.
+func WithIDGenerator(gen func() string) Option {
+	return func(c *Client) {
+		c.idGenerator = gen
+	}
+}
+
+// OnOutgoing calls fn once for every message the client sends, meta messages
+// included, just before its request is encoded. It is meant for observation
+// such as audit logging; fn must not modify the message.
+func OnOutgoing(fn func(*message.BayeuxMessage)) Option {
+	return func(c *Client) {
+		c.onOutgoing = fn
+	}
+}
+
+// OnIncoming calls fn once for every message the client receives, meta
+// messages included, before it is handled or dispatched. Like OnOutgoing it
+// is observe-only; fn must not modify the message.
+func OnIncoming(fn func(*message.BayeuxMessage)) Option {
+	return func(c *Client) {
+		c.onIncoming = fn
+	}
+}
+
+// WithSequenceField watches the monotonic sequence number the server stamps
+// in Data[fieldName] of messages on channel, reporting skipped numbers to the
+// OnSequenceGap hook. It may be given once per channel.
+func WithSequenceField(channel, fieldName string) Option {
+	return func(c *Client) {
+		c.sequenceFields[channel] = fieldName
+	}
+}
+
+// OnSequenceGap calls fn when a message on a channel configured with
+// WithSequenceField carries a sequence number beyond the expected next one,
+// for instance to trigger a resync. It runs on the dispatch path, before the
+// message reaches its handlers.
+func OnSequenceGap(fn func(channel string, expected, got int64)) Option {
+	return func(c *Client) {
+		c.onSequenceGap = fn
+	}
+}
+
+// WithSuccessInference treats an acknowledgement without a successful field
+// as successful when it carries no error either, for lenient servers that
+// omit the field. By default such an ack is a failure.
+func WithSuccessInference(enabled bool) Option {
+	return func(c *Client) {
+		c.successInference = enabled
+	}
+}
+
+// WithSubscribeConfirmer lets fn decide whether the server's response to a
+// subscribe request confirms it, for servers that signal success in a
+// nonstandard way, such as a field in the ack's data. A false result fails
+// the subscribe with the response's error, a non-nil error fails it with that
+// error. By default the response's successful flag decides, see
+// WithSuccessInference.
+func WithSubscribeConfirmer(fn func(request, response *message.BayeuxMessage) (bool, error)) Option {
+	return func(c *Client) {
+		c.subscribeConfirmer = fn
+	}
+}
+
+// WithMaxConcurrentRequests bounds how many handshake, subscribe, publish and
+// other requests are in flight at once to n, queueing the rest until a slot
+// frees up or their context is done. The connect long poll is not counted.
+// A non-positive n leaves requests unbounded.
+func WithMaxConcurrentRequests(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.requestSlots = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithHandlerTimeout watches every handler invocation and reports the ones
+// still running after d to the OnSlowHandler hook. With WithOrderedHandlers
+// the following handlers stop waiting for a slow one after d too; it keeps
+// running, but no longer blocks them.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.handlerTimeout = d
+	}
+}
+
+// WithStateListener calls fn with the old and new state on every change of
+// the client's ConnectionState. It is called on the goroutine that made the
+// change, without holding any of the client's locks, so it may call back
+// into the client; it should return quickly, as the connect loop waits for
+// it.
+func WithStateListener(fn func(old, new ConnectionState)) Option {
+	return func(c *Client) {
+		c.stateListener = fn
+	}
+}
+
+// OnUnhandledMessage calls fn, on its own goroutine, with each data message
+// that arrives on a channel no handler is registered on, for example one the
+// server delivered before it processed an unsubscribe. A handler removed
+// while the message was being dispatched may still receive it instead.
+// Without the hook such messages are dropped.
+func OnUnhandledMessage(fn func(msg *message.BayeuxMessage)) Option {
+	return func(c *Client) {
+		c.onUnhandled = fn
+	}
+}
+
+// OnSlowHandler calls fn with the message channel and the time spent so far
+// when a handler exceeds the WithHandlerTimeout limit. It is called at most
+// once per invocation, while the handler is still running.
+func OnSlowHandler(fn func(channel string, elapsed time.Duration)) Option {
+	return func(c *Client) {
+		c.onSlowHandler = fn
+	}
+}
+
+// WithAsyncSubscribeAck accepts /meta/subscribe acknowledgements that the
+// server delivers later on the connect channel instead of in the subscribe
+// response. Subscribe, like the subscribes of a Batch, stamps its request
+// with an id and waits, up to a fixed timeout, for the ack carrying it; the
+// connect loop must be running for a deferred ack to arrive.
+func WithAsyncSubscribeAck(enabled bool) Option {
+	return func(c *Client) {
+		c.asyncSubscribeAck = enabled
+	}
+}
+
+// WithErrorWriter writes handler panics, with their stack, and connect loop
+// errors to w as timestamped, newline-terminated lines. Without it panics go
+// to stdout and loop errors are only passed to WithErrorHandler. The client
+// serializes its writes, so w need not be safe for concurrent use.
+func WithErrorWriter(w io.Writer) Option {
+	return func(c *Client) {
+		c.errorWriter = w
+	}
+}
+
+// WithErrorLogRate limits the lines written for the same failure, by kind,
+// channel and first line of text, to n per period, so that a handler
+// panicking on every message of a storm cannot flood the error writer. The
+// lines held back are summarized as "N similar panics suppressed" before the
+// next line for that failure. WithErrorHandler still sees every error.
+func WithErrorLogRate(n int, per time.Duration) Option {
+	return func(c *Client) {
+		if n <= 0 || per <= 0 {
+			c.optErr = errors.Join(c.optErr, errors.New("error log rate must be positive"))
+			return
+		}
+		c.errorLog = &errorLogLimiter{n: n, per: per, windows: make(map[string]*errorLogWindow)}
+	}
+}
+
+// WithRequestBuilder replaces how the HTTP request carrying each Bayeux batch
+// is built, for deployments that need a custom Host, trailers or body
+// encoding. build receives the server URL and the JSON-encoded batch and must
+// return a request bound to ctx; the response is decoded as usual.
+func WithRequestBuilder(build func(ctx context.Context, url string, body []byte) (*http.Request, error)) Option {
+	return func(c *Client) {
+		c.requestBuilder = build
+	}
+}
+
+// WithTracer wraps every handshake, subscribe, publish, connect, unsubscribe
+// and disconnect request in a span from tracer, and injects the span's
+// propagation headers into the request.
+func WithTracer(tracer Tracer) Option {
+	return func(c *Client) {
+		c.tracer = tracer
+	}
+}
+
+// WithBufferPublishesDuringReconnect holds up to n publishes made while the
+// connect loop is reestablishing the session, sending them once it succeeds
+// instead of failing against the stale session. Publish blocks while held,
+// as does a batch commit carrying publishes; beyond n held requests they
+// fail with ErrPublishBufferFull.
+func WithBufferPublishesDuringReconnect(n int) Option {
+	return func(c *Client) {
+		c.publishBuffer = n
+	}
+}
+
+// WithChannelMatcher replaces the Bayeux glob semantics dispatch uses to
+// match message channels against the channels handlers were registered on.
+// Handlers on the message's exact channel always receive it.
+func WithChannelMatcher(m ChannelMatcher) Option {
+	return func(c *Client) {
+		c.matcher = m
+	}
+}
+
+// WithMinConnectInterval sets the least time the connect loop waits after a
+// successful poll before polling again. The interval the server advises is
+// honored when it is longer.
+func WithMinConnectInterval(d time.Duration) Option {
+	return func(c *Client) {
+		c.minConnectInterval = d
+	}
+}
+
+// OnKeepalive calls fn each time a connect cycle succeeds with an empty
+// batch. It runs on the loop goroutine and must not block.
+func OnKeepalive(fn func()) Option {
+	return func(c *Client) {
+		c.onKeepalive = fn
+	}
+}
+
+// WithChannelQueue delivers the messages of channel to its handlers one at a
+// time, in arrival order, holding up to depth of them while a delivery is in
+// progress. Once depth are waiting, policy decides whether the oldest or the
+// newest message is dropped or dispatch blocks until there is room. It may be
+// given once per channel.
+func WithChannelQueue(channel string, depth int, policy OverflowPolicy) Option {
+	return func(c *Client) {
+		if depth < 1 {
+			c.optErr = errors.Join(c.optErr, fmt.Errorf("invalid queue depth %d for %s", depth, channel))
+			return
+		}
+		if c.channelQueues == nil {
+			c.channelQueues = make(map[string]*channelQueue)
+		}
+		c.channelQueues[channel] = newChannelQueue(depth, policy)
+	}
+}
+
+// WithPublishDedup makes Publish and batched publishes suppress, with
+// ErrDuplicateSuppressed, a publish whose channel, data and ext, such as a
+// PublishIfMatch version, match one made within window, for instance a retry
+// of a publish that did reach the server. A publish counts as seen from the
+// moment it is attempted, so that concurrent duplicates are caught, but is
+// forgotten again if it fails, so that the caller may retry it.
+func WithPublishDedup(window time.Duration) Option {
+	return func(c *Client) {
+		c.dedupWindow = window
+		c.dedupSeen = make(map[[sha256.Size]byte]time.Time)
+	}
+}
+
+// WithServerURLs gives the client a list of equivalent servers to fail over
+// between, replacing the URL passed to NewClient; the first one is used
+// initially. When the connect loop fails against the current server as many
+// times in a row as WithFailoverThreshold allows, it moves to the next one,
+// round-robin, handshakes there and resubscribes every channel.
+func WithServerURLs(urls []string) Option {
+	return func(c *Client) {
+		if len(urls) == 0 {
+			c.optErr = errors.Join(c.optErr, errors.New("no server URLs"))
+			return
+		}
+		c.serverURLs = urls
+		c.serverIndex = 0
+		c.serverURL = urls[0]
+	}
+}
+
+// WithFastestServer makes the first handshake of a client configured with
+// WithServerURLs go to every server at once. The client settles on the first
+// server to accept it, cancels the other handshakes and disconnects any
+// session they opened regardless. Later handshakes, such as those after a
+// failover, go to the current server only.
+func WithFastestServer(enabled bool) Option {
+	return func(c *Client) {
+		c.fastestServer = enabled
+	}
+}
+
+// OnOrphanedSubscription calls fn with each channel that could not be
+// resubscribed after a failover or a Connect following Disconnect, and the
+// error of the last attempt. The channel keeps its handlers, but receives
+// nothing until subscribed again. See WithResubscribeGrace.
+func OnOrphanedSubscription(fn func(channel string, err error)) Option {
+	return func(c *Client) {
+		c.onOrphanedSubscription = fn
+	}
+}
+
+// WithAutoResubscribe controls whether the client subscribes its new session
+// again to every channel that still has handlers whenever a fresh handshake
+// replaces the previous one: after a rehandshake or failover of the connect
+// loop, and on the Connect following any other handshake, such as one made
+// after Disconnect. It is on by default; turn it
+// off to resubscribe by hand, for example from OnClientIDChange.
+func WithAutoResubscribe(enabled bool) Option {
+	return func(c *Client) {
+		c.autoResubscribe = enabled
+	}
+}
+
+// WithResubscribeGrace keeps retrying a failed resubscribe in the background
+// for d before OnOrphanedSubscription reports it, so that a server slow to
+// accept the new session does not raise a false alarm. By default a channel
+// is reported as soon as its resubscribe fails.
+func WithResubscribeGrace(d time.Duration) Option {
+	return func(c *Client) {
+		c.resubscribeGrace = d
+	}
+}
+
+// WithHandshakeExtFunc calls fn at every handshake, the first one and those
+// that reestablish a lost session, and sends the map it returns as the
+// handshake's ext object, so that a short-lived credential can be minted
+// afresh each time. fn runs before the extensions see the handshake.
+func WithHandshakeExtFunc(fn func() map[string]interface{}) Option {
+	return func(c *Client) {
+		c.handshakeExtFunc = fn
+	}
+}
+
+// WithBackoff makes the connect loop wait initial after a failed poll, then
+// factor times longer after each further failure in a row, up to max, instead
+// of a fixed second. The delay goes back to initial after a successful poll.
+// An interval advised by the server is still honored as a minimum.
+func WithBackoff(initial, max time.Duration, factor float64) Option {
+	return func(c *Client) {
+		if initial <= 0 || max < initial || factor < 1 {
+			c.optErr = errors.Join(c.optErr, errors.New("invalid backoff: need 0 < initial <= max and factor >= 1"))
+			return
+		}
+		c.backoffInitial = initial
+		c.backoffMax = max
+		c.backoffFactor = factor
+	}
+}
+
+// WithBackoffJitter shortens each WithBackoff delay by a random amount of up
+// to fraction of it, between 0 and 1, so that clients failing together do not
+// retry in lockstep.
+func WithBackoffJitter(fraction float64) Option {
+	return func(c *Client) {
+		c.backoffJitter = min(max(fraction, 0), 1)
+	}
+}
+
+// WithMaxRehandshakes bounds how many handshakes in a row the connect loop
+// attempts after the server reports the session lost, for instance with an
+// unknown-client error after a restart. Once they have all failed the loop
+// stops with the last error. The default is 5; n <= 0 removes the bound.
+// Handshakes after a WithServerURLs failover are not counted.
+func WithMaxRehandshakes(n int) Option {
+	return func(c *Client) {
+		c.maxRehandshakes = n
+	}
+}
+
+// OnClientIDChange calls fn with the old and new client ids each time the
+// connect loop recovers a lost session with a new handshake, after the
+// registered channels have been resubscribed.
+func OnClientIDChange(fn func(oldID, newID string)) Option {
+	return func(c *Client) {
+		c.onClientIDChange = fn
+	}
+}
+
+// WithFailoverThreshold sets how many consecutive connect failures against
+// one server WithServerURLs tolerates before failing over. The default is 3.
+func WithFailoverThreshold(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.failoverThreshold = n
+		}
+	}
+}
+
+// WithExtension adds ext to the extensions every sent and received message
+// passes through, in the order they were added.
+func WithExtension(ext Extension) Option {
+	return func(c *Client) {
+		c.extensions = append(c.extensions, ext)
+	}
+}
+
+// WithExtensionErrorHandler registers a callback for extensions that return
+// an error or panic; failure is the error or the panic value. The message
+// continues without that extension's changes. fn runs on the send or receive
+// path and must not block.
+func WithExtensionErrorHandler(fn func(ext Extension, failure interface{})) Option {
+	return func(c *Client) {
+		c.extensionErrorHandler = fn
+	}
+}
+
+// WithAbortOnExtensionError makes a failing outgoing extension abort the
+// send with an *ExtensionError instead of letting the message go out without
+// its changes. Incoming messages are never dropped.
+func WithAbortOnExtensionError(enabled bool) Option {
+	return func(c *Client) {
+		c.abortOnExtensionError = enabled
+	}
+}
+
+// WithPerChannelWorker runs the handlers of each registered channel on a
+// long-lived goroutine of its own, started with the channel's first handler
+// and stopped with its last. Messages of a channel are handled one at a time
+// in arrival order, while different channels proceed in parallel.
+func WithPerChannelWorker(enabled bool) Option {
+	return func(c *Client) {
+		c.perChannelWorker = enabled
+		c.workers = make(map[string]*channelWorker)
+	}
+}
+
+// WithDedupServerSubscribe makes Subscribe skip the /meta/subscribe request
+// when the server has already confirmed the session's subscription to the
+// channel, registering only the additional local handler.
+func WithDedupServerSubscribe(enabled bool) Option {
+	return func(c *Client) {
+		c.dedupServerSubscribe = enabled
+	}
+}
+
+// WithRestartOnLoopPanic keeps the connect loop running after it recovers
+// from a panic in its own code, such as an extension or hook called on the
+// loop goroutine, treating it like a failed poll. By default the loop stops
+// and ServeContext returns a *LoopPanicError. Either way the panic is
+// written out like a handler panic.
+func WithRestartOnLoopPanic(enabled bool) Option {
+	return func(c *Client) {
+		c.restartOnLoopPanic = enabled
+	}
+}
+
+// WithHTTPTrace instruments every request with net/http/httptrace to time
+// DNS lookup, TCP connect and TLS handshake apart from the server round trip,
+// reporting them to the OnConnectionTiming hook.
+func WithHTTPTrace(enabled bool) Option {
+	return func(c *Client) {
+		c.httpTrace = enabled
+	}
+}
+
+// OnConnectionTiming calls fn with the timing of each request once its
+// response headers arrive, when WithHTTPTrace is enabled. It runs on the
+// requesting goroutine and must not block.
+func OnConnectionTiming(fn func(ConnectionTiming)) Option {
+	return func(c *Client) {
+		c.onConnectionTiming = fn
+	}
+}
+
+// WithMaxSubscriptions caps the number of distinct channels with handlers at
+// n, as a guard against runaway subscription growth. Subscribe to a new
+// channel beyond it fails with ErrTooManySubscriptions; more handlers on an
+// already subscribed channel are still accepted.
+func WithMaxSubscriptions(n int) Option {
+	return func(c *Client) {
+		c.maxSubscriptions = n
+	}
+}
+
+// WithMaxHandlers caps the total number of registered handlers, across all
+// channels, at n. Subscribe beyond it fails with ErrTooManySubscriptions.
+func WithMaxHandlers(n int) Option {
+	return func(c *Client) {
+		c.maxHandlers = n
+	}
+}
+
+// WithClientTimestamp stamps every outgoing message, meta messages included,
+// with the client's send time as milliseconds since the Unix epoch in
+// ext.clientTimestamp, so the server can measure one-way latency. Use
+// WithClientTimestampField to pick another ext field.
+func WithClientTimestamp(enabled bool) Option {
+	return func(c *Client) {
+		c.timestampField = ""
+		if enabled {
+			c.timestampField = "clientTimestamp"
+		}
+	}
+}
+
+// WithClientTimestampField stamps outgoing messages like WithClientTimestamp,
+// under ext[name].
+func WithClientTimestampField(name string) Option {
+	return func(c *Client) {
+		c.timestampField = name
+	}
+}
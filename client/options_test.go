@@ -0,0 +1,200 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestWithProxy(t *testing.T) {
+	var proxiedHost, proxyAuth string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.URL.Host
+		proxyAuth = r.Header.Get("Proxy-Authorization")
+		resp := []message.BayeuxMessage{{
+			Channel:    "/meta/handshake",
+			ClientID:   "proxied-client-id",
+			Successful: boolPtr(true),
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "secret")
+
+	c := NewClient("http://bayeux.example/cometd", WithProxy(proxyURL.String()))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake through proxy failed: %v", err)
+	}
+	if proxiedHost != "bayeux.example" {
+		t.Errorf("Expected the request for bayeux.example to reach the proxy, got host %q", proxiedHost)
+	}
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	if proxyAuth != want {
+		t.Errorf("Expected Proxy-Authorization %q, got %q", want, proxyAuth)
+	}
+}
+
+func TestWithProxyFunc(t *testing.T) {
+	proxied := 0
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		resp := []message.BayeuxMessage{{Channel: "/foo", Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	c := NewClient("http://bayeux.example/cometd", WithProxyFunc(func(r *http.Request) (*url.URL, error) {
+		return proxyURL, nil
+	}))
+	c.clientID = "test-client-id"
+	if err := c.Publish("/foo", map[string]interface{}{"msg": "hello"}); err != nil {
+		t.Fatalf("Publish through proxy failed: %v", err)
+	}
+	if proxied != 1 {
+		t.Errorf("Expected 1 proxied request, got %d", proxied)
+	}
+}
+
+func TestWithProxyInvalidURL(t *testing.T) {
+	c := NewClient("http://bayeux.example/cometd", WithProxy("://bad"))
+	if err := c.Handshake(); err == nil || !strings.Contains(err.Error(), "invalid proxy URL") {
+		t.Errorf("Expected an invalid proxy URL error, got %v", err)
+	}
+}
+
+func TestWithResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewClient(server.URL, WithResponseHeaderTimeout(50*time.Millisecond))
+	start := time.Now()
+	if err := c.Handshake(); err == nil {
+		t.Fatalf("Expected handshake against a stalled server to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the header timeout to fail fast, took %v", elapsed)
+	}
+}
+
+// countingTransport counts the requests it forwards to http.DefaultTransport.
+type countingTransport struct {
+	mu       sync.Mutex
+	channels []string
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	var reqMsgs []message.BayeuxMessage
+	_ = json.Unmarshal(body, &reqMsgs)
+	t.mu.Lock()
+	t.channels = append(t.channels, reqMsgs[0].Channel)
+	t.mu.Unlock()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: reqMsgs[0].Channel, ClientID: "test-client-id", Successful: boolPtr(true)}})
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	c := NewClient(server.URL, WithHTTPClient(&http.Client{Transport: transport}))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := c.Publish("/foo", nil); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := c.PollOnce(context.Background()); err != nil {
+		t.Fatalf("PollOnce failed: %v", err)
+	}
+	if err := c.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+
+	want := []string{"/meta/handshake", "/meta/subscribe", "/foo", "/meta/connect", "/meta/disconnect"}
+	if !reflect.DeepEqual(transport.channels, want) {
+		t.Errorf("Expected every request through the custom client, got %v", transport.channels)
+	}
+
+	mixed := NewClient(server.URL, WithHTTPClient(&http.Client{}), WithTLSHandshakeTimeout(time.Second))
+	if err := mixed.Handshake(); err == nil || !strings.Contains(err.Error(), "WithHTTPClient") {
+		t.Errorf("Expected WithHTTPClient with a transport option to be rejected, got %v", err)
+	}
+}
+
+func TestWithTLSHandshakeTimeout(t *testing.T) {
+	c := NewClient("https://bayeux.example/cometd", WithTLSHandshakeTimeout(2*time.Second))
+	if c.transport == nil || c.transport.TLSHandshakeTimeout != 2*time.Second {
+		t.Fatalf("Expected the client transport to carry the TLS handshake timeout")
+	}
+	if http.DefaultTransport.(*http.Transport).TLSHandshakeTimeout == 2*time.Second {
+		t.Errorf("Expected http.DefaultTransport to be left untouched")
+	}
+}
+
+func TestWithRequestBuilder(t *testing.T) {
+	var gotHost, gotHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		gotHeader = r.Header.Get("X-Tenant")
+		resp := []message.BayeuxMessage{{
+			Channel:    "/meta/handshake",
+			ClientID:   "built-client-id",
+			Successful: boolPtr(true),
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithRequestBuilder(func(ctx context.Context, url string, body []byte) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Host = "bayeux.internal"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Tenant", "acme")
+		return req, nil
+	}))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if gotHost != "bayeux.internal" || gotHeader != "acme" {
+		t.Errorf("Expected the custom request, got host %q and tenant %q", gotHost, gotHeader)
+	}
+	if c.clientID != "built-client-id" {
+		t.Errorf("Expected the response to be decoded, got clientId %q", c.clientID)
+	}
+}
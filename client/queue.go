@@ -0,0 +1,115 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// OverflowPolicy decides what a channel queue set up by WithChannelQueue does
+// with a message arriving while it is full.
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest queued message to make room, counted in
+	// Stats.DroppedOldest.
+	DropOldest OverflowPolicy = iota
+	// DropNewest discards the arriving message, counted in
+	// Stats.DroppedNewest.
+	DropNewest
+	// Block holds up dispatch, and with it the connect loop, until the
+	// channel's handlers catch up.
+	Block
+)
+
+// queuedMessage is a message waiting in a channel queue together with the
+// handlers it was dispatched to.
+type queuedMessage struct {
+	msg      *message.BayeuxMessage
+	handlers []handlerEntry
+}
+
+// channelQueue delivers the messages of one channel to their handlers one at
+// a time, holding at most depth of them while a delivery is in progress. Its
+// worker goroutine only runs while the queue is non-empty.
+type channelQueue struct {
+	depth  int
+	policy OverflowPolicy
+
+	mu      sync.Mutex
+	space   *sync.Cond
+	items   []queuedMessage
+	running bool
+}
+
+func newChannelQueue(depth int, policy OverflowPolicy) *channelQueue {
+	q := &channelQueue{depth: depth, policy: policy}
+	q.space = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues m, applying the overflow policy when the queue is full, and
+// starts a worker running deliver if none is. It reports whether a message
+// was dropped.
+func (q *channelQueue) push(m queuedMessage, deliver func(queuedMessage)) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.policy == Block && len(q.items) >= q.depth {
+		q.space.Wait()
+	}
+	dropped := len(q.items) >= q.depth
+	if dropped {
+		if q.policy == DropNewest {
+			return true
+		}
+		q.items = q.items[1:]
+	}
+	q.items = append(q.items, m)
+	if !q.running {
+		q.running = true
+		go q.drain(deliver)
+	}
+	return dropped
+}
+
+// drain delivers queued messages until the queue is empty.
+func (q *channelQueue) drain(deliver func(queuedMessage)) {
+	for {
+		q.mu.Lock()
+		if len(q.items) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		m := q.items[0]
+		q.items = q.items[1:]
+		q.space.Signal()
+		q.mu.Unlock()
+
+		deliver(m)
+	}
+}
+
+// enqueue hands msg to the queue configured for its channel, if there is
+// one, and reports whether it did.
+func (c *Client) enqueue(msg *message.BayeuxMessage, handlers []handlerEntry) bool {
+	q := c.channelQueues[msg.Channel]
+	if q == nil {
+		return false
+	}
+	dropped := q.push(queuedMessage{msg: msg, handlers: handlers}, func(m queuedMessage) {
+		for _, entry := range m.handlers {
+			c.invokeWithin(entry, handlerCopy(m.msg, len(m.handlers)))
+		}
+	})
+	if dropped {
+		c.updateStats(func(s *Stats) {
+			if q.policy == DropNewest {
+				s.DroppedNewest++
+			} else {
+				s.DroppedOldest++
+			}
+		})
+	}
+	return true
+}
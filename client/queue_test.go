@@ -0,0 +1,74 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestChannelQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     OverflowPolicy
+		want       []int
+		wantOldest uint64
+		wantNewest uint64
+	}{
+		{"drop oldest", DropOldest, []int{0, 3, 4}, 2, 0},
+		{"drop newest", DropNewest, []int{0, 1, 2}, 0, 2},
+		{"block", Block, []int{0, 1, 2, 3, 4}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient("http://example.com/bayeux", WithChannelQueue("/foo", 2, tt.policy))
+			release := make(chan struct{})
+			got := make(chan int, 10)
+			c.handlers["/foo"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) {
+				if msg.Data["n"] == 0 {
+					<-release
+				}
+				got <- msg.Data["n"].(int)
+			}}}
+
+			dispatched := make(chan struct{})
+			go func() {
+				for n := 0; n < 5; n++ {
+					c.dispatch(&message.BayeuxMessage{Channel: "/foo", Data: map[string]interface{}{"n": n}})
+					if n == 0 {
+						time.Sleep(20 * time.Millisecond)
+					}
+				}
+				close(dispatched)
+			}()
+			if tt.policy == Block {
+				select {
+				case <-dispatched:
+					t.Fatalf("Expected dispatch to block on a full queue")
+				case <-time.After(50 * time.Millisecond):
+				}
+			} else {
+				<-dispatched
+			}
+			close(release)
+			<-dispatched
+
+			var order []int
+			for range tt.want {
+				select {
+				case n := <-got:
+					order = append(order, n)
+				case <-time.After(time.Second):
+					t.Fatalf("Expected %v to be delivered, got %v", tt.want, order)
+				}
+			}
+			if !reflect.DeepEqual(order, tt.want) {
+				t.Errorf("Expected delivery order %v, got %v", tt.want, order)
+			}
+			if s := c.Stats(); s.DroppedOldest != tt.wantOldest || s.DroppedNewest != tt.wantNewest {
+				t.Errorf("Expected drops %d/%d, got %d/%d", tt.wantOldest, tt.wantNewest, s.DroppedOldest, s.DroppedNewest)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// rawDataMessage is an outgoing message whose data is sent as given rather
+// than marshalled from a map. Its Data field shadows the embedded one.
+type rawDataMessage struct {
+	extMessage
+	Data json.RawMessage `json:"data"`
+}
+
+// PublishRaw publishes data, which must be a JSON object, to channel exactly
+// as given, so that its key order is kept where Publish would sort the keys
+// of a map. Only insignificant whitespace is removed. Extensions and the
+// OnOutgoing hook see the message without its data. Retries work as for
+// Publish, but WithPublishDedup does not apply.
+func (c *Client) PublishRaw(channel string, data json.RawMessage) error {
+	return c.PublishRawContext(context.Background(), channel, data)
+}
+
+// PublishRawContext is PublishRaw bound to ctx.
+func (c *Client) PublishRawContext(ctx context.Context, channel string, data json.RawMessage) error {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return fmt.Errorf("Error on the publish request: data is not a JSON object")
+	}
+	return c.publishRetrying(ctx, message.BayeuxMessage{Channel: channel}, nil, data)
+}
+
+// marshalRaw marshals v like json.Marshal, but without escaping HTML
+// characters, which would alter the raw data of a rawDataMessage.
+func marshalRaw(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestPublishRaw(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		body = string(raw)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: "/foo", Successful: boolPtr(true)}})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	if err := c.PublishRaw("/foo", json.RawMessage(`{"z": 1, "a": "<b>", "m": [2, 1]}`)); err != nil {
+		t.Fatalf("PublishRaw failed: %v", err)
+	}
+	if !strings.Contains(body, `"data":{"z":1,"a":"<b>","m":[2,1]}`) {
+		t.Errorf("Expected the data to keep its key order, got %s", body)
+	}
+	if strings.Count(body, `"data"`) != 1 {
+		t.Errorf("Expected a single data field, got %s", body)
+	}
+
+	for _, bad := range []string{`[1]`, `null`, `{"a":`} {
+		if err := c.PublishRaw("/foo", json.RawMessage(bad)); err == nil {
+			t.Errorf("Expected %s to be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// beginReconnect marks the session as being reestablished by the connect
+// loop. It is idempotent while a reconnect is already in progress.
+func (c *Client) beginReconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reconnecting == nil {
+		c.reconnecting = make(chan struct{})
+	}
+}
+
+// endReconnect ends the reconnect in progress, if any, releasing the
+// publishes held back by awaitReconnect.
+func (c *Client) endReconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reconnecting != nil {
+		close(c.reconnecting)
+		c.reconnecting = nil
+	}
+}
+
+// awaitReconnect holds a publish back while the connect loop reestablishes
+// the session under WithBufferPublishesDuringReconnect, so it is sent with the
+// new client id instead of failing. Once the buffer is full, further
+// publishes fail with ErrPublishBufferFull.
+func (c *Client) awaitReconnect(ctx context.Context) error {
+	c.mu.Lock()
+	reconnecting := c.reconnecting
+	if reconnecting == nil || c.publishBuffer <= 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	if c.heldPublishes >= c.publishBuffer {
+		c.mu.Unlock()
+		return ErrPublishBufferFull
+	}
+	c.heldPublishes++
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.heldPublishes--
+		c.mu.Unlock()
+	}()
+	select {
+	case <-reconnecting:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Error waiting for the reconnect: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestBufferPublishesDuringReconnect(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var publishedBy []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		req := reqMsgs[0]
+		resp := message.BayeuxMessage{Channel: req.Channel, Successful: boolPtr(true)}
+		switch req.Channel {
+		case "/meta/handshake":
+			<-release
+			resp.ClientID = "new-client-id"
+		case "/meta/connect":
+			if req.ClientID != "new-client-id" {
+				resp.Successful = boolPtr(false)
+				resp.Error = "402::unknown client"
+			} else {
+				time.Sleep(10 * time.Millisecond)
+			}
+		default:
+			mu.Lock()
+			publishedBy = append(publishedBy, req.ClientID)
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{resp})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithBufferPublishesDuringReconnect(1))
+	c.clientID = "old-client-id"
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Disconnect()
+
+	for deadline := time.Now().Add(time.Second); ; {
+		c.mu.Lock()
+		reconnecting := c.reconnecting != nil
+		c.mu.Unlock()
+		if reconnecting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Reconnect not started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	held := make(chan error, 1)
+	go func() { held <- c.Publish("/foo", map[string]interface{}{"n": 1}) }()
+	for deadline := time.Now().Add(time.Second); ; {
+		c.mu.Lock()
+		n := c.heldPublishes
+		c.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Publish not held during reconnect")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := c.Publish("/foo", map[string]interface{}{"n": 2}); !errors.Is(err, ErrPublishBufferFull) {
+		t.Errorf("Expected ErrPublishBufferFull beyond the buffer, got %v", err)
+	}
+
+	close(release)
+	select {
+	case err := <-held:
+		if err != nil {
+			t.Fatalf("Held publish failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Held publish not flushed after reconnect")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(publishedBy) != 1 || publishedBy[0] != "new-client-id" {
+		t.Errorf("Expected one publish with the new client id, got %v", publishedBy)
+	}
+}
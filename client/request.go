@@ -0,0 +1,109 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// Operation identifies a kind of Bayeux request for BuildRequest.
+type Operation string
+
+const (
+	OpHandshake   Operation = "handshake"
+	OpConnect     Operation = "connect"
+	OpSubscribe   Operation = "subscribe"
+	OpUnsubscribe Operation = "unsubscribe"
+	OpPublish     Operation = "publish"
+	OpDisconnect  Operation = "disconnect"
+)
+
+// BuildRequest returns the batch the client would send for op, without
+// sending it, so that message construction can be tested without a server.
+// channel is the subscription for OpSubscribe and OpUnsubscribe and the
+// destination for OpPublish; data is only used by OpPublish. Extensions are
+// applied, but the OnOutgoing hook is not called. The handshake's version
+// and supportedConnectionTypes are not part of the returned message. Ids
+// assigned at send time, such as those of service calls, are not included
+// either.
+func (c *Client) BuildRequest(channel string, op Operation, data map[string]interface{}) ([]message.BayeuxMessage, error) {
+	if c.optErr != nil {
+		return nil, fmt.Errorf("invalid client option: %w", c.optErr)
+	}
+	var msg message.BayeuxMessage
+	switch op {
+	case OpHandshake:
+		msg = c.handshakeMessage().BayeuxMessage
+	case OpConnect:
+		msg = c.connectMessage()
+	case OpSubscribe:
+		if isMetaChannel(channel) {
+			return nil, fmt.Errorf("Error on the subscription request: %s is a reserved meta channel", channel)
+		}
+		msg = c.subscribeMessage(channel)
+	case OpUnsubscribe:
+		msg = c.unsubscribeMessage(channel)
+	case OpPublish:
+		msg = c.publishRequest(channel, data)
+	case OpDisconnect:
+		msg = c.disconnectMessage()
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op)
+	}
+	if err := c.applyOutgoing(&msg); err != nil {
+		return nil, err
+	}
+	return []message.BayeuxMessage{msg}, nil
+}
+
+// handshakeMessage builds the /meta/handshake request.
+func (c *Client) handshakeMessage() handshakeRequest {
+	return handshakeRequest{
+		BayeuxMessage:            message.BayeuxMessage{Channel: "/meta/handshake"},
+		Version:                  BayeuxVersion,
+		SupportedConnectionTypes: c.connectionTypes,
+	}
+}
+
+// connectMessage builds a /meta/connect request for the current session.
+func (c *Client) connectMessage() message.BayeuxMessage {
+	return message.BayeuxMessage{
+		Channel:  "/meta/connect",
+		ClientID: c.getClientID(),
+	}
+}
+
+// subscribeMessage builds the /meta/subscribe request for channel.
+func (c *Client) subscribeMessage(channel string) message.BayeuxMessage {
+	return message.BayeuxMessage{
+		Channel:      "/meta/subscribe",
+		ClientID:     c.getClientID(),
+		Subscription: channel,
+	}
+}
+
+// unsubscribeMessage builds the /meta/unsubscribe request for channel.
+func (c *Client) unsubscribeMessage(channel string) message.BayeuxMessage {
+	return message.BayeuxMessage{
+		Channel:      "/meta/unsubscribe",
+		ClientID:     c.getClientID(),
+		Subscription: channel,
+	}
+}
+
+// publishRequest builds the message publishing data to channel.
+func (c *Client) publishRequest(channel string, data map[string]interface{}) message.BayeuxMessage {
+	return message.BayeuxMessage{
+		Channel:  channel,
+		ClientID: c.getClientID(),
+		Data:     data,
+	}
+}
+
+// disconnectMessage builds the /meta/disconnect request.
+func (c *Client) disconnectMessage() message.BayeuxMessage {
+	return message.BayeuxMessage{
+		Channel:  "/meta/disconnect",
+		ClientID: c.getClientID(),
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestBuildRequest(t *testing.T) {
+	c := NewClient("http://example.com/bayeux")
+	c.clientID = "test-client-id"
+
+	msgs, err := c.BuildRequest("/foo", OpPublish, map[string]interface{}{"n": 1})
+	if err != nil {
+		t.Fatalf("BuildRequest failed: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Channel != "/foo" || msgs[0].ClientID != "test-client-id" || msgs[0].Data["n"] != 1 {
+		t.Errorf("Expected a publish to /foo, got %+v", msgs)
+	}
+
+	msgs, err = c.BuildRequest("/foo", OpSubscribe, nil)
+	if err != nil || msgs[0].Channel != "/meta/subscribe" || msgs[0].Subscription != "/foo" {
+		t.Errorf("Expected a /meta/subscribe to /foo, got %+v, %v", msgs, err)
+	}
+	if _, err := c.BuildRequest("/meta/connect", OpSubscribe, nil); err == nil {
+		t.Errorf("Expected subscribing to a meta channel to fail")
+	}
+	if _, err := c.BuildRequest("", Operation("bogus"), nil); err == nil {
+		t.Errorf("Expected an unknown operation to fail")
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// RetryDecision tells the connect loop or the publish retry logic what to do
+// after a failed request.
+type RetryDecision int
+
+const (
+	// Retry repeats the request after the usual delay.
+	Retry RetryDecision = iota
+	// Stop gives up: Publish returns the error, the connect loop stops.
+	Stop
+	// Rehandshake performs a new handshake and then repeats the request with
+	// the new session.
+	Rehandshake
+)
+
+// RetryClassifier decides how to react to a failed request. resp is the HTTP
+// response for failures caused by a non-2xx status and nil otherwise; Bayeux
+// level failures are reported as a *ServerError in err.
+type RetryClassifier func(err error, resp *http.Response) RetryDecision
+
+// defaultMaxRehandshakes is how many handshakes in a row the connect loop
+// attempts for a lost session before giving up, see WithMaxRehandshakes.
+const defaultMaxRehandshakes = 5
+
+// needsHandshake reports whether err says the session is gone, either
+// through a reconnect:"handshake" advice or an unknown-client error, by code
+// or by message for servers that send no code.
+func needsHandshake(err error) bool {
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	if serverErr.Advice != nil && serverErr.Advice.Reconnect == "handshake" {
+		return true
+	}
+	return serverErr.Code == 401 || serverErr.Code == 402 || strings.Contains(strings.ToLower(serverErr.Message), "unknown client")
+}
+
+// defaultPublishClassifier retries transient failures only, so a server
+// rejection is never repeated.
+func defaultPublishClassifier(err error, resp *http.Response) RetryDecision {
+	if IsTransient(err) {
+		return Retry
+	}
+	return Stop
+}
+
+// defaultConnectClassifier keeps the connect loop polling through anything
+// but cancellation, an explicit reconnect:"none" advice or a lost session.
+func defaultConnectClassifier(err error, resp *http.Response) RetryDecision {
+	if errors.Is(err, context.Canceled) {
+		return Stop
+	}
+	if needsHandshake(err) {
+		return Rehandshake
+	}
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) && serverErr.Advice != nil && serverErr.Advice.Reconnect == "none" {
+		return Stop
+	}
+	return Retry
+}
+
+// responseOf returns the HTTP response carried by err, if any.
+func responseOf(err error) *http.Response {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Response
+	}
+	return nil
+}
+
+// classify applies the configured RetryClassifier to err, falling back to
+// fallback when none was set.
+func (c *Client) classify(err error, fallback RetryClassifier) RetryDecision {
+	if c.retryClassifier != nil {
+		return c.retryClassifier(err, responseOf(err))
+	}
+	return fallback(err, responseOf(err))
+}
@@ -0,0 +1,358 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestDefaultClassifiers(t *testing.T) {
+	unknown := &ServerError{Channel: "/meta/connect", Code: 402, Message: "Unknown client"}
+	advisedHandshake := &ServerError{Channel: "/meta/connect", Advice: &message.Advice{Reconnect: "handshake"}}
+	advisedNone := &ServerError{Channel: "/meta/connect", Advice: &message.Advice{Reconnect: "none"}}
+	denied := &ServerError{Channel: "/foo", Code: 403}
+	unavailable := &HTTPError{StatusCode: 503}
+
+	tests := []struct {
+		name      string
+		err       error
+		publish   RetryDecision
+		connectTo RetryDecision
+	}{
+		{"unknown client", unknown, Stop, Rehandshake},
+		{"handshake advice", advisedHandshake, Stop, Rehandshake},
+		{"none advice", advisedNone, Stop, Stop},
+		{"denied", denied, Stop, Retry},
+		{"unavailable", unavailable, Retry, Retry},
+		{"cancelled", context.Canceled, Stop, Stop},
+	}
+	for _, tt := range tests {
+		if got := defaultPublishClassifier(tt.err, nil); got != tt.publish {
+			t.Errorf("%s: expected publish decision %d, got %d", tt.name, tt.publish, got)
+		}
+		if got := defaultConnectClassifier(tt.err, nil); got != tt.connectTo {
+			t.Errorf("%s: expected connect decision %d, got %d", tt.name, tt.connectTo, got)
+		}
+	}
+}
+
+func TestRetryClassifierPublish(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-Give-Up", "true")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var seen *http.Response
+	c := NewClient(server.URL,
+		WithPublishRetry(3, time.Millisecond),
+		WithRetryClassifier(func(err error, resp *http.Response) RetryDecision {
+			seen = resp
+			if resp != nil && resp.Header.Get("X-Give-Up") == "true" {
+				return Stop
+			}
+			return Retry
+		}),
+	)
+	c.clientID = "test-client-id"
+
+	if err := c.Publish("/foo", nil); err == nil {
+		t.Fatalf("Expected publish to fail")
+	}
+	if requests != 1 {
+		t.Errorf("Expected the classifier to stop after 1 request, got %d", requests)
+	}
+	if seen == nil || seen.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the classifier to see the 503 response, got %+v", seen)
+	}
+}
+
+func TestPublishRehandshakeResubscribes(t *testing.T) {
+	var requests []string
+	handshakes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		req := reqMsgs[0]
+		resp := []message.BayeuxMessage{{Channel: req.Channel, Subscription: req.Subscription, Successful: boolPtr(true)}}
+		switch req.Channel {
+		case "/meta/handshake":
+			handshakes++
+			resp[0].ClientID = fmt.Sprintf("session-%d", handshakes)
+			requests = append(requests, req.Channel)
+		case "/meta/subscribe":
+			requests = append(requests, req.Channel+"@"+req.ClientID+" "+req.Subscription)
+		default:
+			requests = append(requests, req.Channel+"@"+req.ClientID)
+			if req.ClientID != fmt.Sprintf("session-%d", handshakes) || handshakes == 1 {
+				resp[0].Successful = boolPtr(false)
+				resp[0].Error = "402::Unknown client"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	var changes []string
+	c := NewClient(server.URL,
+		WithPublishRetry(1, time.Millisecond),
+		WithRetryClassifier(func(err error, resp *http.Response) RetryDecision {
+			return Rehandshake
+		}),
+		OnClientIDChange(func(oldID, newID string) {
+			changes = append(changes, oldID+"->"+newID)
+		}),
+	)
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if _, err := c.Subscribe("/a", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := c.Publish("/pub", map[string]interface{}{"n": 1}); err != nil {
+		t.Fatalf("Expected the publish to succeed on the new session, got %v", err)
+	}
+
+	want := []string{
+		"/meta/handshake", "/meta/subscribe@session-1 /a", "/pub@session-1",
+		"/meta/handshake", "/meta/subscribe@session-2 /a", "/pub@session-2",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("Expected requests %v, got %v", want, requests)
+	}
+	if !reflect.DeepEqual(changes, []string{"session-1->session-2"}) {
+		t.Errorf("Expected the client id change to be reported, got %v", changes)
+	}
+}
+
+func TestConnectLoopRehandshake(t *testing.T) {
+	var mu sync.Mutex
+	var channels []string
+	var connectedAs []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		defer mu.Unlock()
+		req := reqMsgs[0]
+		channels = append(channels, req.Channel)
+		resp := []message.BayeuxMessage{{Channel: req.Channel, Successful: boolPtr(true)}}
+		switch req.Channel {
+		case "/meta/handshake":
+			resp[0].ClientID = "fresh-client-id"
+		case "/meta/connect":
+			connectedAs = append(connectedAs, req.ClientID)
+			if req.ClientID != "fresh-client-id" {
+				resp[0].Successful = boolPtr(false)
+				resp[0].Error = "402::Unknown client"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "stale-client-id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.ServeContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the loop to run until the deadline, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(channels) < 3 || channels[0] != "/meta/connect" || channels[1] != "/meta/handshake" || channels[2] != "/meta/connect" {
+		t.Fatalf("Expected connect, handshake, connect, got %v", channels)
+	}
+	if connectedAs[1] != "fresh-client-id" {
+		t.Errorf("Expected the loop to reconnect with the new clientID, got %q", connectedAs[1])
+	}
+}
+
+func TestConnectLoopRecoversUnknownClient(t *testing.T) {
+	var mu sync.Mutex
+	var subscribedAs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		defer mu.Unlock()
+		req := reqMsgs[0]
+		resp := []message.BayeuxMessage{{Channel: req.Channel, Successful: boolPtr(true)}}
+		switch req.Channel {
+		case "/meta/handshake":
+			resp[0].ClientID = "fresh-client-id"
+		case "/meta/subscribe":
+			subscribedAs = append(subscribedAs, req.ClientID)
+		case "/meta/connect":
+			if req.ClientID != "fresh-client-id" {
+				resp[0].Successful = boolPtr(false)
+				resp[0].Error = "Unknown client"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	changes := make(chan [2]string, 1)
+	c := NewClient(server.URL, OnClientIDChange(func(oldID, newID string) {
+		changes <- [2]string{oldID, newID}
+	}))
+	c.clientID = "stale-client-id"
+	if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.ServeContext(ctx)
+
+	select {
+	case change := <-changes:
+		if change != [2]string{"stale-client-id", "fresh-client-id"} {
+			t.Errorf("Expected the change from the stale to the fresh id, got %v", change)
+		}
+	default:
+		t.Errorf("Expected OnClientIDChange to be called")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(subscribedAs) != 2 || subscribedAs[1] != "fresh-client-id" {
+		t.Errorf("Expected /foo to be resubscribed with the new session, got %v", subscribedAs)
+	}
+}
+
+func TestAutoResubscribe(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		var mu sync.Mutex
+		var resubscribed []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var reqMsgs []message.BayeuxMessage
+			_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+			mu.Lock()
+			defer mu.Unlock()
+			req := reqMsgs[0]
+			resp := []message.BayeuxMessage{{Channel: req.Channel, Successful: boolPtr(true)}}
+			switch req.Channel {
+			case "/meta/handshake":
+				resp[0].ClientID = "fresh-client-id"
+			case "/meta/subscribe":
+				if req.ClientID == "fresh-client-id" {
+					resubscribed = append(resubscribed, req.Subscription)
+				}
+			case "/meta/connect":
+				if req.ClientID != "fresh-client-id" {
+					resp[0].Successful = boolPtr(false)
+					resp[0].Error = "402::Unknown client"
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+		}))
+
+		c := NewClient(server.URL, WithAutoResubscribe(enabled))
+		c.clientID = "stale-client-id"
+		for _, channel := range []string{"/foo", "/bar"} {
+			if _, err := c.Subscribe(channel, func(msg *message.BayeuxMessage) {}); err != nil {
+				t.Fatalf("Subscribe failed: %v", err)
+			}
+		}
+		c.store.Add("/gone")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		c.ServeContext(ctx)
+		cancel()
+		server.Close()
+
+		mu.Lock()
+		sort.Strings(resubscribed)
+		if enabled && !reflect.DeepEqual(resubscribed, []string{"/bar", "/foo"}) {
+			t.Errorf("Expected every channel with handlers to be resubscribed, got %v", resubscribed)
+		}
+		if !enabled && len(resubscribed) != 0 {
+			t.Errorf("Expected no resubscribe with WithAutoResubscribe(false), got %v", resubscribed)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestConnectLoopRehandshakeBound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		resp := []message.BayeuxMessage{{Channel: reqMsgs[0].Channel, Successful: boolPtr(false), Error: "402::Unknown client"}}
+		if reqMsgs[0].Channel == "/meta/handshake" {
+			resp[0].Error = "503::overloaded"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithMaxRehandshakes(1))
+	c.clientID = "stale-client-id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := c.ServeContext(ctx)
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Code != 503 {
+		t.Errorf("Expected the loop to give up with the handshake error, got %v", err)
+	}
+}
+
+func TestConnectLoopHonorsAdvice(t *testing.T) {
+	var mu sync.Mutex
+	connects := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connects++
+		n := connects
+		mu.Unlock()
+		resp := message.BayeuxMessage{Channel: "/meta/connect", Successful: boolPtr(false), Error: "overloaded"}
+		resp.Advice = &message.Advice{Reconnect: "retry", Interval: 10}
+		if n == 5 {
+			resp.Advice.Reconnect = "none"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{resp})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	start := time.Now()
+	err := c.ServeContext(context.Background())
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Advice == nil || serverErr.Advice.Reconnect != "none" {
+		t.Fatalf("Expected the loop to stop on reconnect none, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the advised 10ms interval between failed polls, took %v", elapsed)
+	}
+	if info := c.Info(); info.State != "idle" {
+		t.Errorf("Expected the client not to be running, got %s", info.State)
+	}
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// defaultRPCTimeout bounds an RPC call whose context has no deadline.
+const defaultRPCTimeout = 30 * time.Second
+
+// RPC is a request/reply layer over a service channel in the style of
+// JSON-RPC: each call publishes {"method", "params", "id"} and waits for the
+// reply correlated with it, whose data carries either "result" or "error".
+// Replies are matched like CallService's, so the connect loop must be
+// running unless the server answers within the publish response.
+type RPC struct {
+	c       *Client
+	channel string
+	// Timeout bounds calls whose context has no deadline of its own.
+	Timeout time.Duration
+}
+
+// NewRPC returns an RPC calling methods on serviceChannel through c.
+func NewRPC(c *Client, serviceChannel string) *RPC {
+	return &RPC{c: c, channel: serviceChannel, Timeout: defaultRPCTimeout}
+}
+
+// RPCError is the error a remote method reported in its reply.
+type RPCError struct {
+	Code    int
+	Message string
+	Data    interface{}
+}
+
+func (e *RPCError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("rpc error: %s", e.Message)
+}
+
+// Call invokes method with params, which must be JSON-encodable, and returns
+// the raw JSON result. An error in the reply is returned as an *RPCError.
+func (r *RPC) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	if _, ok := ctx.Deadline(); !ok && r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	reply, err := r.c.callService(ctx, r.channel, func(id string) map[string]interface{} {
+		return map[string]interface{}{"method": method, "params": params, "id": id}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error calling %s: %w", method, err)
+	}
+	if e, ok := reply.Data["error"]; ok && e != nil {
+		return nil, rpcError(e)
+	}
+	result, err := json.Marshal(reply.Data["result"])
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding the result of %s: %w", method, err)
+	}
+	return result, nil
+}
+
+// rpcError maps the error member of a reply, either an object with code,
+// message and data or a bare value, to an RPCError.
+func rpcError(e interface{}) *RPCError {
+	obj, ok := e.(map[string]interface{})
+	if !ok {
+		return &RPCError{Message: fmt.Sprint(e)}
+	}
+	rpcErr := &RPCError{Data: obj["data"]}
+	if msg, ok := obj["message"].(string); ok {
+		rpcErr.Message = msg
+	}
+	switch code := obj["code"].(type) {
+	case float64:
+		rpcErr.Code = int(code)
+	case json.Number:
+		n, _ := code.Int64()
+		rpcErr.Code = int(n)
+	}
+	return rpcErr
+}
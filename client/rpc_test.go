@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestRPCCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		req := reqMsgs[0]
+		reply := message.BayeuxMessage{Channel: req.Channel, ID: req.ID, Data: map[string]interface{}{"id": req.Data["id"]}}
+		switch req.Data["method"] {
+		case "add":
+			params := req.Data["params"].([]interface{})
+			reply.Data["result"] = params[0].(float64) + params[1].(float64)
+		default:
+			reply.Data["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+		resp := []message.BayeuxMessage{{Channel: req.Channel, Successful: boolPtr(true), ID: req.ID}, reply}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	rpc := NewRPC(c, "/service/calc")
+
+	result, err := rpc.Call(context.Background(), "add", []int{2, 3})
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if string(result) != "5" {
+		t.Errorf("Expected result 5, got %s", result)
+	}
+
+	_, err = rpc.Call(context.Background(), "missing", nil)
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32601 || rpcErr.Message != "method not found" {
+		t.Errorf("Expected a method-not-found RPCError, got %v", err)
+	}
+}
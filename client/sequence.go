@@ -0,0 +1,33 @@
+package client
+
+import "github.com/charlinchui/galliard/message"
+
+// checkSequence compares the sequence number carried by msg on a channel
+// configured with WithSequenceField against the last one seen there, and
+// reports a skip ahead to the OnSequenceGap hook. The last sequence survives
+// reconnects, so messages missed while disconnected show up as a gap too.
+// Messages without a readable sequence, and late or repeated ones, are
+// passed through without updating the expectation.
+func (c *Client) checkSequence(msg *message.BayeuxMessage) {
+	field, ok := c.sequenceFields[msg.Channel]
+	if !ok {
+		return
+	}
+	got, err := DataInt64(msg, field)
+	if err != nil {
+		return
+	}
+
+	c.sequenceMu.Lock()
+	last, seen := c.lastSequence[msg.Channel]
+	if seen && got <= last {
+		c.sequenceMu.Unlock()
+		return
+	}
+	c.lastSequence[msg.Channel] = got
+	c.sequenceMu.Unlock()
+
+	if seen && got > last+1 && c.onSequenceGap != nil {
+		c.onSequenceGap(msg.Channel, last+1, got)
+	}
+}
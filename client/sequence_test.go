@@ -0,0 +1,33 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestSequenceGap(t *testing.T) {
+	type gap struct {
+		channel       string
+		expected, got int64
+	}
+	var gaps []gap
+	c := NewClient("http://example.com/bayeux",
+		WithSequenceField("/orders", "seq"),
+		OnSequenceGap(func(channel string, expected, got int64) {
+			gaps = append(gaps, gap{channel, expected, got})
+		}),
+	)
+
+	for _, seq := range []float64{1, 2, 5, 3, 6, 9} {
+		c.checkSequence(&message.BayeuxMessage{Channel: "/orders", Data: map[string]interface{}{"seq": seq}})
+	}
+	c.checkSequence(&message.BayeuxMessage{Channel: "/orders", Data: map[string]interface{}{}})
+	c.checkSequence(&message.BayeuxMessage{Channel: "/other", Data: map[string]interface{}{"seq": 100.0}})
+
+	want := []gap{{"/orders", 3, 5}, {"/orders", 7, 9}}
+	if !reflect.DeepEqual(gaps, want) {
+		t.Errorf("Expected gaps %v, got %v", want, gaps)
+	}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// newMessageID returns the next message id for this client, from the
+// generator set by WithIDGenerator or an incrementing counter. Calls are
+// serialized, so the generator needs no locking of its own.
+func (c *Client) newMessageID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.idGenerator != nil {
+		return c.idGenerator()
+	}
+	c.nextMessageID++
+	return strconv.Itoa(c.nextMessageID)
+}
+
+// pendingCall is a CallService waiting for its reply on channel.
+type pendingCall struct {
+	channel string
+	reply   chan *message.BayeuxMessage
+}
+
+// CallService publishes data to a service channel and waits for the reply
+// correlated with it, using the field configured by WithCorrelationField.
+// Replies are normally delivered through the connect loop, so Connect must be
+// running unless the server answers within the publish response itself.
+func (c *Client) CallService(ctx context.Context, channel string, data map[string]interface{}) (*message.BayeuxMessage, error) {
+	return c.callService(ctx, channel, func(string) map[string]interface{} { return data })
+}
+
+// callService implements CallService, building the request data with the
+// call's id from build.
+func (c *Client) callService(ctx context.Context, channel string, build func(id string) map[string]interface{}) (*message.BayeuxMessage, error) {
+	if err := c.ensureHandshake(ctx); err != nil {
+		return nil, err
+	}
+	id := c.newMessageID()
+	data := build(id)
+
+	reqMsg := c.publishRequest(channel, data)
+	reqMsg.ID = id
+	if c.correlationField != "id" {
+		reqMsg.Data = make(map[string]interface{}, len(data)+1)
+		for k, v := range data {
+			reqMsg.Data[k] = v
+		}
+		reqMsg.Data[c.correlationField] = id
+	}
+
+	reply := make(chan *message.BayeuxMessage, 1)
+	c.callsMu.Lock()
+	c.calls[id] = pendingCall{channel: channel, reply: reply}
+	c.callsMu.Unlock()
+	defer func() {
+		c.callsMu.Lock()
+		delete(c.calls, id)
+		c.callsMu.Unlock()
+	}()
+
+	respMsgs, err := c.publishMessage(ctx, reqMsg, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error on the service call: %w", err)
+	}
+	for i := range respMsgs {
+		c.deliverReply(&respMsgs[i])
+	}
+
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("Error waiting for the service reply: %w", ctx.Err())
+	}
+}
+
+// correlationOf returns the correlation value carried by a service reply.
+// Publish acknowledgements carry the request id too, but no data, so only
+// messages with data are considered replies.
+func (c *Client) correlationOf(msg *message.BayeuxMessage) (string, bool) {
+	if msg.Data == nil {
+		return "", false
+	}
+	if c.correlationField == "id" {
+		return msg.ID, msg.ID != ""
+	}
+	v, ok := msg.Data[c.correlationField]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// deliverReply hands msg to a pending CallService waiting for it and reports
+// whether it was consumed. A reply must arrive on the service channel the
+// call was published to, so that a message on another channel whose id
+// happens to match is still dispatched to its subscribers.
+func (c *Client) deliverReply(msg *message.BayeuxMessage) bool {
+	id, ok := c.correlationOf(msg)
+	if !ok {
+		return false
+	}
+	c.callsMu.Lock()
+	call, ok := c.calls[id]
+	ok = ok && call.channel == msg.Channel
+	if ok {
+		delete(c.calls, id)
+	}
+	c.callsMu.Unlock()
+	if ok {
+		call.reply <- msg
+	}
+	return ok
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestCallService(t *testing.T) {
+	var mu sync.Mutex
+	var queued []message.BayeuxMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		defer mu.Unlock()
+		req := reqMsgs[0]
+		resp := []message.BayeuxMessage{{Channel: req.Channel, Successful: boolPtr(true), ID: req.ID}}
+		switch req.Channel {
+		case "/meta/connect":
+			resp = append(resp, queued...)
+			queued = nil
+		case "/service/echo":
+			queued = append(queued, message.BayeuxMessage{
+				Channel: "/service/echo",
+				ID:      req.ID,
+				Data:    map[string]interface{}{"echo": req.Data["msg"]},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	reply, err := c.CallService(ctx, "/service/echo", map[string]interface{}{"msg": "hello"})
+	if err != nil {
+		t.Fatalf("CallService failed: %v", err)
+	}
+	if reply.Data["echo"] != "hello" {
+		t.Errorf("Expected echo 'hello', got %+v", reply.Data)
+	}
+}
+
+func TestCallServiceIgnoresOtherChannels(t *testing.T) {
+	var mu sync.Mutex
+	var queued []message.BayeuxMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		mu.Lock()
+		defer mu.Unlock()
+		req := reqMsgs[0]
+		resp := []message.BayeuxMessage{{Channel: req.Channel, Successful: boolPtr(true), ID: req.ID, Subscription: req.Subscription}}
+		switch req.Channel {
+		case "/meta/connect":
+			resp = append(resp, queued...)
+			queued = nil
+		case "/service/echo":
+			queued = append(queued,
+				message.BayeuxMessage{Channel: "/chat", ID: req.ID, Data: map[string]interface{}{"text": "unrelated"}},
+				message.BayeuxMessage{Channel: "/service/echo", ID: req.ID, Data: map[string]interface{}{"echo": req.Data["msg"]}},
+			)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	chat := make(chan *message.BayeuxMessage, 1)
+	if _, err := c.Subscribe("/chat", func(msg *message.BayeuxMessage) { chat <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Disconnect()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	reply, err := c.CallService(ctx, "/service/echo", map[string]interface{}{"msg": "hello"})
+	if err != nil {
+		t.Fatalf("CallService failed: %v", err)
+	}
+	if reply.Channel != "/service/echo" || reply.Data["echo"] != "hello" {
+		t.Errorf("Expected the reply on /service/echo, got %+v", reply)
+	}
+	select {
+	case msg := <-chat:
+		if msg.Data["text"] != "unrelated" {
+			t.Errorf("Expected the /chat message, got %+v", msg.Data)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the /chat message with a colliding id to reach its subscriber")
+	}
+}
+
+func TestCallServiceCorrelationField(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		req := reqMsgs[0]
+		if req.Data["requestId"] == nil {
+			t.Errorf("Expected requestId in request data, got %+v", req.Data)
+		}
+		resp := []message.BayeuxMessage{
+			{Channel: req.Channel, Successful: boolPtr(true)},
+			{Channel: req.Channel, Data: map[string]interface{}{"requestId": "unrelated"}},
+			{Channel: req.Channel, Data: map[string]interface{}{"requestId": req.Data["requestId"], "ok": true}},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithCorrelationField("requestId"))
+	c.clientID = "test-client-id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	reply, err := c.CallService(ctx, "/service/echo", map[string]interface{}{"msg": "hello"})
+	if err != nil {
+		t.Fatalf("CallService failed: %v", err)
+	}
+	if reply.Data["ok"] != true {
+		t.Errorf("Expected the correlated reply, got %+v", reply.Data)
+	}
+}
+
+func TestCallServiceTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := []message.BayeuxMessage{{Channel: "/service/echo", Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.CallService(ctx, "/service/echo", nil); err == nil {
+		t.Errorf("Expected CallService to time out without a reply")
+	}
+
+	c.callsMu.Lock()
+	pending := len(c.calls)
+	c.callsMu.Unlock()
+	if pending != 0 {
+		t.Errorf("Expected pending calls to be cleaned up, got %d", pending)
+	}
+}
+
+func TestCallServiceIDGenerator(t *testing.T) {
+	var seenID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		req := reqMsgs[0]
+		seenID = req.ID
+		resp := []message.BayeuxMessage{
+			{Channel: req.Channel, Successful: boolPtr(true), ID: req.ID},
+			{Channel: req.Channel, ID: req.ID, Data: map[string]interface{}{"ok": true}},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	n := 0
+	c := NewClient(server.URL, WithIDGenerator(func() string {
+		n++
+		return fmt.Sprintf("trace-%d", n)
+	}))
+	c.clientID = "test-client-id"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	reply, err := c.CallService(ctx, "/service/echo", nil)
+	if err != nil {
+		t.Fatalf("CallService failed: %v", err)
+	}
+	if seenID != "trace-1" || reply.ID != "trace-1" {
+		t.Errorf("Expected generated id trace-1 on request and reply, got %q and %q", seenID, reply.ID)
+	}
+}
+
+func TestIDGeneratorStampsAllTraffic(t *testing.T) {
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		req := reqMsgs[0]
+		ids = append(ids, req.Channel+"="+req.ID)
+		resp := []message.BayeuxMessage{{Channel: req.Channel, ID: req.ID, ClientID: "test-client-id", Subscription: req.Subscription, Successful: boolPtr(true)}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	n := 0
+	c := NewClient(server.URL, WithIDGenerator(func() string {
+		n++
+		return fmt.Sprintf("trace-%d", n)
+	}))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := c.Publish("/foo", map[string]interface{}{"n": 1}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	want := []string{"/meta/handshake=trace-1", "/meta/subscribe=trace-2", "/foo=trace-3"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected generated ids %v, got %v", want, ids)
+	}
+}
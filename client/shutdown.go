@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ShutdownError reports the steps of Shutdown that did not complete, in the
+// order they were attempted, and why.
+type ShutdownError struct {
+	// Incomplete names the failed steps: "stop", "drain", "unsubscribe",
+	// "disconnect" or "flush".
+	Incomplete []string
+	// Err joins the errors of the failed steps.
+	Err error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("partial shutdown, incomplete %s: %v", strings.Join(e.Incomplete, ", "), e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error { return e.Err }
+
+// beginHandler counts a handler invocation as running, for Shutdown to wait
+// for.
+func (c *Client) beginHandler() {
+	c.runningMu.Lock()
+	defer c.runningMu.Unlock()
+	if c.running == 0 {
+		c.handlersIdle = make(chan struct{})
+	}
+	c.running++
+}
+
+// endHandler counts a handler invocation as finished, waking drainHandlers
+// once none is left.
+func (c *Client) endHandler() {
+	c.runningMu.Lock()
+	defer c.runningMu.Unlock()
+	c.running--
+	if c.running == 0 {
+		close(c.handlersIdle)
+	}
+}
+
+// drainHandlers waits until no handler is running or ctx is done.
+func (c *Client) drainHandlers(ctx context.Context) error {
+	c.runningMu.Lock()
+	if c.running == 0 {
+		c.runningMu.Unlock()
+		return nil
+	}
+	idle := c.handlersIdle
+	c.runningMu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Error waiting for handlers to finish: %w", ctx.Err())
+	}
+}
+
+// awaitLoopStop waits for a connect loop stopped by stopLoop to exit.
+func (c *Client) awaitLoopStop(ctx context.Context) error {
+	c.mu.Lock()
+	if c.state != loopRunning && c.state != loopStopping {
+		c.mu.Unlock()
+		return nil
+	}
+	stopped := c.stopped
+	c.mu.Unlock()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Error waiting for the connect loop to stop: %w", ctx.Err())
+	}
+}
+
+// Shutdown winds the client down within ctx's deadline: it stops the connect
+// loop, flushes batched subscriptions and waits for running handlers, drops
+// every subscription on the server, sends /meta/disconnect, flushes buffered
+// sinks implementing Flusher and closes idle connections. Every step is
+// attempted even if an earlier one failed. If any did not complete, for
+// instance because ctx expired, a *ShutdownError lists them. Since it waits
+// for running handlers, a handler that wants to end the session should call
+// Disconnect instead.
+func (c *Client) Shutdown(ctx context.Context) error {
+	var incomplete []string
+	var errs []error
+	step := func(name string, err error) {
+		if err != nil {
+			incomplete = append(incomplete, name)
+			errs = append(errs, err)
+		}
+	}
+
+	c.stopLoop()
+	step("stop", c.awaitLoopStop(ctx))
+	c.flushBatches()
+	step("drain", c.drainHandlers(ctx))
+
+	c.handlersMu.RLock()
+	channels := make([]string, 0, len(c.handlers))
+	for ch := range c.handlers {
+		channels = append(channels, ch)
+	}
+	c.handlersMu.RUnlock()
+	step("unsubscribe", c.unsubscribeChannels(ctx, c.dropHandlers(channels)))
+	step("disconnect", c.disconnect(ctx))
+	step("flush", c.flushSinks())
+
+	c.httpClient.CloseIdleConnections()
+
+	if len(incomplete) > 0 {
+		return &ShutdownError{Incomplete: incomplete, Err: errors.Join(errs...)}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var channels []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		mu.Lock()
+		channels = append(channels, reqMsgs[0].Channel)
+		mu.Unlock()
+
+		resp := make([]message.BayeuxMessage, len(reqMsgs))
+		for i, m := range reqMsgs {
+			resp[i] = message.BayeuxMessage{Channel: m.Channel, Subscription: m.Subscription, Successful: boolPtr(true)}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	finished := false
+	if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {
+		time.Sleep(20 * time.Millisecond)
+		finished = true
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+	time.Sleep(5 * time.Millisecond)
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if !finished {
+		t.Errorf("Expected Shutdown to wait for the running handler")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"/meta/subscribe", "/meta/unsubscribe", "/meta/disconnect"}; !reflect.DeepEqual(channels, want) {
+		t.Errorf("Expected requests %v, got %v", want, channels)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	c := NewClient("http://example.com/bayeux")
+	c.handlers["/foo"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) {
+		time.Sleep(time.Second)
+	}}}
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+	time.Sleep(5 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := c.Shutdown(ctx)
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) || shutdownErr.Incomplete[0] != "drain" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a partial shutdown starting at the drain, got %v", err)
+	}
+}
+
+func TestDisconnectFromHandler(t *testing.T) {
+	disconnects := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		if reqMsgs[0].Channel == "/meta/disconnect" {
+			disconnects <- struct{}{}
+		}
+		resp := make([]message.BayeuxMessage, len(reqMsgs))
+		for i, m := range reqMsgs {
+			resp[i] = message.BayeuxMessage{Channel: m.Channel, Subscription: m.Subscription, Successful: boolPtr(true)}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+	results := make(chan error, 2)
+	c.handlers["/disconnect"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) {
+		results <- c.Disconnect()
+	}}}
+	var mu sync.Mutex
+	var batches [][]*message.BayeuxMessage
+	if _, err := c.SubscribeBatch("/batch", 2, time.Minute, func(msgs []*message.BayeuxMessage) {
+		mu.Lock()
+		batches = append(batches, msgs)
+		first := len(batches) == 1
+		mu.Unlock()
+		if first {
+			c.dispatch(&message.BayeuxMessage{Channel: "/batch"})
+			time.Sleep(20 * time.Millisecond)
+			results <- c.Disconnect()
+		}
+	}); err != nil {
+		t.Fatalf("SubscribeBatch failed: %v", err)
+	}
+
+	for _, channel := range []string{"/disconnect", "/batch"} {
+		c.dispatch(&message.BayeuxMessage{Channel: channel})
+		if channel == "/batch" {
+			c.dispatch(&message.BayeuxMessage{Channel: channel})
+		}
+		select {
+		case err := <-results:
+			if err != nil {
+				t.Errorf("Expected Disconnect from a %s handler to succeed, got %v", channel, err)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("Expected Disconnect from a %s handler not to deadlock", channel)
+		}
+		select {
+		case <-disconnects:
+		case <-time.After(time.Second):
+			t.Errorf("Expected Disconnect from a %s handler to reach the server", channel)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Errorf("Expected the batch flushed by Disconnect to follow the running one, got %v", batches)
+	}
+}
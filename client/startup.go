@@ -0,0 +1,54 @@
+package client
+
+import (
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// startupBufferGrace bounds how long buffered startup messages wait for
+// ReleaseStartupBuffer before they are replayed anyway.
+const startupBufferGrace = 5 * time.Second
+
+// bufferStartup holds msg back while the startup buffer configured by
+// WithStartupBuffer is still open, and reports whether it did. A full buffer
+// is released, so messages are never dropped, only delivered early.
+func (c *Client) bufferStartup(msg *message.BayeuxMessage) bool {
+	c.startupMu.Lock()
+	if c.startupReleased || c.startupBufferSize <= 0 {
+		c.startupMu.Unlock()
+		return false
+	}
+	c.startupBuffer = append(c.startupBuffer, msg)
+	if c.startupTimer == nil {
+		c.startupTimer = time.AfterFunc(startupBufferGrace, c.ReleaseStartupBuffer)
+	}
+	full := len(c.startupBuffer) >= c.startupBufferSize
+	c.startupMu.Unlock()
+
+	if full {
+		c.ReleaseStartupBuffer()
+	}
+	return true
+}
+
+// ReleaseStartupBuffer replays the messages held back by WithStartupBuffer
+// to the handlers registered by now, in the order they were received, and
+// dispatches every later message directly. Call it once the application has
+// registered all of its handlers. It is a no-op without WithStartupBuffer or
+// when the buffer has already been released.
+func (c *Client) ReleaseStartupBuffer() {
+	c.startupMu.Lock()
+	defer c.startupMu.Unlock()
+	if c.startupReleased {
+		return
+	}
+	c.startupReleased = true
+	if c.startupTimer != nil {
+		c.startupTimer.Stop()
+	}
+	for _, msg := range c.startupBuffer {
+		c.dispatch(msg)
+	}
+	c.startupBuffer = nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestStartupBuffer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/connect","successful":true},{"channel":"/foo","data":{"n":1}},{"channel":"/foo","data":{"n":2}}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithStartupBuffer(10), WithOrderedHandlers(true))
+	c.clientID = "test-client-id"
+
+	if err := c.connectOnce(context.Background()); err != nil {
+		t.Fatalf("connectOnce failed: %v", err)
+	}
+
+	received := make(chan *message.BayeuxMessage, 4)
+	c.handlers["/foo"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) { received <- msg }}}
+	select {
+	case <-received:
+		t.Fatalf("Expected messages to be buffered until release")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.ReleaseStartupBuffer()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("Buffered message %d not replayed", i+1)
+		}
+	}
+
+	if err := c.connectOnce(context.Background()); err != nil {
+		t.Fatalf("connectOnce failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("Message %d after release not dispatched", i+1)
+		}
+	}
+}
+
+func TestStartupBufferReleasesWhenFull(t *testing.T) {
+	c := NewClient("http://example.com/bayeux", WithStartupBuffer(2))
+
+	received := make(chan *message.BayeuxMessage, 2)
+	c.handlers["/foo"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) { received <- msg }}}
+
+	if !c.bufferStartup(&message.BayeuxMessage{Channel: "/foo"}) {
+		t.Fatalf("Expected first message to be buffered")
+	}
+	select {
+	case <-received:
+		t.Fatalf("Expected message to be held back")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.bufferStartup(&message.BayeuxMessage{Channel: "/foo"})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("Full buffer not released")
+		}
+	}
+	if c.bufferStartup(&message.BayeuxMessage{Channel: "/foo"}) {
+		t.Errorf("Expected no buffering after release")
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import "slices"
+
+// ConnectionState is the client's connection state as seen by
+// WithStateListener.
+type ConnectionState int
+
+const (
+	// Disconnected means there is no session, or no connect loop to keep it
+	// alive: before the first handshake, after a failed one, after Disconnect
+	// and once the connect loop has exited.
+	Disconnected ConnectionState = iota
+	// Handshaking means a handshake started while Disconnected is in flight.
+	Handshaking
+	// Connected means the last handshake or /meta/connect succeeded.
+	Connected
+	// Reconnecting means a /meta/connect of the connect loop failed and the
+	// loop is retrying, rehandshaking if need be, until a poll succeeds.
+	Reconnecting
+)
+
+// String returns the state's name.
+func (s ConnectionState) String() string {
+	switch s {
+	case Handshaking:
+		return "handshaking"
+	case Connected:
+		return "connected"
+	case Reconnecting:
+		return "reconnecting"
+	}
+	return "disconnected"
+}
+
+// ConnectionState returns the client's current connection state.
+func (c *Client) ConnectionState() ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connState
+}
+
+// changeState moves the client to state to, if its current state is one of
+// from or from is empty, and calls the WithStateListener listener, after
+// releasing mu so that it may call back into the client.
+func (c *Client) changeState(to ConnectionState, from ...ConnectionState) {
+	c.mu.Lock()
+	old := c.connState
+	if old == to || (len(from) > 0 && !slices.Contains(from, old)) {
+		c.mu.Unlock()
+		return
+	}
+	c.connState = to
+	c.mu.Unlock()
+	if c.stateListener != nil {
+		c.stateListener(old, to)
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestStateListener(t *testing.T) {
+	var mu sync.Mutex
+	connects := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		resp := message.BayeuxMessage{Channel: reqMsgs[0].Channel, Successful: boolPtr(true)}
+		switch reqMsgs[0].Channel {
+		case "/meta/handshake":
+			resp.ClientID = "test-client-id"
+			resp.Advice = &message.Advice{Interval: 10}
+		case "/meta/connect":
+			mu.Lock()
+			connects++
+			first := connects == 1
+			mu.Unlock()
+			if first {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{resp})
+	}))
+	defer server.Close()
+
+	type change struct{ old, new ConnectionState }
+	var changes []change
+	var c *Client
+	c = NewClient(server.URL, WithStateListener(func(old, new ConnectionState) {
+		c.ConnectionState()
+		mu.Lock()
+		changes = append(changes, change{old, new})
+		mu.Unlock()
+	}))
+
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(changes)
+		mu.Unlock()
+		if n >= 4 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := c.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []change{
+		{Disconnected, Handshaking},
+		{Handshaking, Connected},
+		{Connected, Reconnecting},
+		{Reconnecting, Connected},
+		{Connected, Disconnected},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Expected the transitions %v, got %v", want, changes)
+	}
+	if got := c.ConnectionState(); got != Disconnected {
+		t.Errorf("Expected the client to end Disconnected, got %s", got)
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import "maps"
+
+// Stats holds counters of the client's activity since it was created or
+// since the last ResetStats.
+type Stats struct {
+	// Handshakes counts successful handshakes.
+	Handshakes uint64
+	// Publishes counts publishes acknowledged by the server, retries and
+	// service calls included.
+	Publishes uint64
+	// ConnectCycles counts /meta/connect cycles that succeeded.
+	ConnectCycles uint64
+	// ConnectErrors counts /meta/connect cycles that failed.
+	ConnectErrors uint64
+	// MessagesReceived counts data messages dispatched to handlers.
+	MessagesReceived uint64
+	// DroppedOldest and DroppedNewest count messages discarded by full
+	// channel queues and Messages buffers under the DropOldest and
+	// DropNewest policies.
+	DroppedOldest uint64
+	DroppedNewest uint64
+	// ChannelMessages counts the data messages dispatched per channel, keyed
+	// by the channel they arrived on. It is nil until the first message.
+	ChannelMessages map[string]uint64
+}
+
+// Stats returns a consistent snapshot of the client's counters.
+func (c *Client) Stats() Stats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	stats := c.stats
+	stats.ChannelMessages = maps.Clone(c.stats.ChannelMessages)
+	return stats
+}
+
+// ResetStats zeroes every counter at once, so that a snapshot taken
+// concurrently sees either all the old values or all zeros.
+func (c *Client) ResetStats() {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats = Stats{}
+}
+
+// countMessage counts a data message received on channel. Once the channel
+// has been seen, counting it again does not allocate.
+func (c *Client) countMessage(channel string) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.MessagesReceived++
+	if c.stats.ChannelMessages == nil {
+		c.stats.ChannelMessages = make(map[string]uint64)
+	}
+	c.stats.ChannelMessages[channel]++
+}
+
+// updateStats applies fn to the counters under the stats lock.
+func (c *Client) updateStats(fn func(*Stats)) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	fn(&c.stats)
+}
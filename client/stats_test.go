@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/connect","successful":true},{"channel":"/foo","data":{"n":1}}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	for i := 0; i < 3; i++ {
+		if err := c.PollOnce(context.Background()); err != nil {
+			t.Fatalf("PollOnce failed: %v", err)
+		}
+	}
+	if got := c.Stats(); got.ConnectCycles != 3 || got.MessagesReceived != 3 || got.ConnectErrors != 0 {
+		t.Errorf("Unexpected stats after three polls: %+v", got)
+	}
+
+	tests := []struct {
+		name  string
+		polls int
+	}{
+		{"one poll", 1},
+		{"two polls", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.ResetStats()
+			for i := 0; i < tt.polls; i++ {
+				c.PollOnce(context.Background())
+			}
+			if got := c.Stats(); got.ConnectCycles != uint64(tt.polls) {
+				t.Errorf("Expected %d connect cycles after reset, got %+v", tt.polls, got)
+			}
+		})
+	}
+}
+
+func TestResetStatsConcurrent(t *testing.T) {
+	c := NewClient("http://example.com/bayeux")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.updateStats(func(s *Stats) { s.Publishes++; s.MessagesReceived++ })
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.ResetStats()
+				if s := c.Stats(); s.Publishes != s.MessagesReceived {
+					t.Errorf("Expected a consistent snapshot, got %+v", s)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestChannelMessages(t *testing.T) {
+	c := NewClient("http://example.com/bayeux")
+	for _, channel := range []string{"/hot", "/hot", "/cold"} {
+		c.dispatch(&message.BayeuxMessage{Channel: channel})
+	}
+
+	snapshot := c.Stats()
+	if snapshot.ChannelMessages["/hot"] != 2 || snapshot.ChannelMessages["/cold"] != 1 {
+		t.Errorf("Expected per-channel counts, got %v", snapshot.ChannelMessages)
+	}
+	c.dispatch(&message.BayeuxMessage{Channel: "/hot"})
+	if snapshot.ChannelMessages["/hot"] != 2 {
+		t.Errorf("Expected the snapshot not to change with later messages")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { c.countMessage("/hot") }); allocs != 0 {
+		t.Errorf("Expected counting a known channel not to allocate, got %v allocations", allocs)
+	}
+
+	c.ResetStats()
+	if got := c.Stats().ChannelMessages; len(got) != 0 {
+		t.Errorf("Expected ResetStats to clear the per-channel counts, got %v", got)
+	}
+}
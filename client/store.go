@@ -0,0 +1,55 @@
+package client
+
+import (
+	"sort"
+	"sync"
+)
+
+// SubscriptionStore records the channels the client wants to be subscribed
+// to, independently of the callbacks registered for them. The client adds a
+// channel once the server confirms its subscription and removes it when the
+// last handler for it goes away; reconnect logic reconciles the server's
+// state against List.
+type SubscriptionStore interface {
+	Add(channel string)
+	Remove(channel string)
+	List() []string
+}
+
+// MemorySubscriptionStore is the default in-memory SubscriptionStore. Fed by
+// the client, it mirrors the channels that have handlers registered.
+type MemorySubscriptionStore struct {
+	mu       sync.Mutex
+	channels map[string]struct{}
+}
+
+// NewMemorySubscriptionStore creates an empty MemorySubscriptionStore.
+func NewMemorySubscriptionStore() *MemorySubscriptionStore {
+	return &MemorySubscriptionStore{channels: make(map[string]struct{})}
+}
+
+// Add records channel as desired.
+func (s *MemorySubscriptionStore) Add(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[channel] = struct{}{}
+}
+
+// Remove forgets channel.
+func (s *MemorySubscriptionStore) Remove(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels, channel)
+}
+
+// List returns the desired channels in sorted order.
+func (s *MemorySubscriptionStore) List() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channels := make([]string, 0, len(s.channels))
+	for ch := range s.channels {
+		channels = append(channels, ch)
+	}
+	sort.Strings(channels)
+	return channels
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+type recordingStore struct {
+	*MemorySubscriptionStore
+	removed []string
+}
+
+func (s *recordingStore) Remove(channel string) {
+	s.removed = append(s.removed, channel)
+	s.MemorySubscriptionStore.Remove(channel)
+}
+
+func TestSubscriptionStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		resp := []message.BayeuxMessage{{
+			Channel:      "/meta/subscribe",
+			Successful:   boolPtr(true),
+			Subscription: reqMsgs[0].Subscription,
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	store := &recordingStore{MemorySubscriptionStore: NewMemorySubscriptionStore()}
+	c := NewClient(server.URL, WithSubscriptionStore(store))
+	c.clientID = "test-client-id"
+
+	unsubFoo1, _ := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	unsubFoo2, _ := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	c.Subscribe("/bar", func(msg *message.BayeuxMessage) {})
+
+	if got := store.List(); !reflect.DeepEqual(got, []string{"/bar", "/foo"}) {
+		t.Errorf("Expected [/bar /foo], got %v", got)
+	}
+
+	unsubFoo1.Unsubscribe()
+	if got := store.List(); !reflect.DeepEqual(got, []string{"/bar", "/foo"}) {
+		t.Errorf("Expected /foo to stay while a handler remains, got %v", got)
+	}
+
+	unsubFoo2.Unsubscribe()
+	unsubFoo2.Unsubscribe()
+	if got := store.List(); !reflect.DeepEqual(got, []string{"/bar"}) {
+		t.Errorf("Expected [/bar], got %v", got)
+	}
+	if !reflect.DeepEqual(store.removed, []string{"/foo"}) {
+		t.Errorf("Expected a single removal of /foo, got %v", store.removed)
+	}
+}
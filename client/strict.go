@@ -0,0 +1,39 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// knownFields is a response message as WithStrictDecode checks it: the
+// fields of message.BayeuxMessage plus those the Bayeux specification
+// defines but the client reads elsewhere or ignores.
+type knownFields struct {
+	message.BayeuxMessage
+	Version                  json.RawMessage `json:"version"`
+	MinimumVersion           json.RawMessage `json:"minimumVersion"`
+	SupportedConnectionTypes json.RawMessage `json:"supportedConnectionTypes"`
+	ConnectionType           json.RawMessage `json:"connectionType"`
+	Timestamp                json.RawMessage `json:"timestamp"`
+	Ext                      json.RawMessage `json:"ext"`
+}
+
+// checkUnknownFields decodes the response raw once more, disallowing unknown
+// fields, and reports the first one found as ErrUnknownField.
+func checkUnknownFields(raw []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var msgs []knownFields
+	err := dec.Decode(&msgs)
+	if err == nil {
+		return nil
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fmt.Errorf("Error decoding the message: %w %s", ErrUnknownField, field)
+	}
+	return fmt.Errorf("Error decoding the message: %w", err)
+}
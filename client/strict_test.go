@@ -0,0 +1,37 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStrictDecode(t *testing.T) {
+	body := `[{"channel":"/foo","successful":true,"ext":{"ack":1},"timestamp":"now"}]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	lenient := NewClient(server.URL)
+	strict := NewClient(server.URL, WithStrictDecode(true))
+	for _, c := range []*Client{lenient, strict} {
+		c.clientID = "test-client-id"
+	}
+
+	if err := strict.Publish("/foo", map[string]interface{}{"n": 1}); err != nil {
+		t.Errorf("Expected fields defined by Bayeux to be accepted, got %v", err)
+	}
+
+	body = `[{"channel":"/foo","successful":true,"priority":3}]`
+	if err := lenient.Publish("/foo", map[string]interface{}{"n": 1}); err != nil {
+		t.Errorf("Expected unknown fields to be ignored by default, got %v", err)
+	}
+	err := strict.Publish("/foo", map[string]interface{}{"n": 1})
+	if !errors.Is(err, ErrUnknownField) || !strings.Contains(err.Error(), "priority") {
+		t.Errorf("Expected an ErrUnknownField naming priority, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// subscribeAckTimeout bounds how long a subscribe under WithAsyncSubscribeAck
+// waits for its acknowledgement to arrive on the connect channel.
+const subscribeAckTimeout = 10 * time.Second
+
+// expectSubscribeAck registers a pending subscribe acknowledgement for id.
+func (c *Client) expectSubscribeAck(id string) chan *message.BayeuxMessage {
+	ack := make(chan *message.BayeuxMessage, 1)
+	c.callsMu.Lock()
+	c.subscribeAcks[id] = ack
+	c.callsMu.Unlock()
+	return ack
+}
+
+// forgetSubscribeAck drops the pending acknowledgement for id, if any.
+func (c *Client) forgetSubscribeAck(id string) {
+	c.callsMu.Lock()
+	delete(c.subscribeAcks, id)
+	c.callsMu.Unlock()
+}
+
+// deliverSubscribeAck hands a /meta/subscribe acknowledgement received on the
+// connect channel to the subscribe waiting for it. Acks nobody waits for are
+// dropped.
+func (c *Client) deliverSubscribeAck(msg *message.BayeuxMessage) {
+	c.callsMu.Lock()
+	ack, ok := c.subscribeAcks[msg.ID]
+	delete(c.subscribeAcks, msg.ID)
+	c.callsMu.Unlock()
+	if ok {
+		ack <- msg
+	}
+}
+
+// awaitSubscribeAck resolves the subscribe req sent under
+// WithAsyncSubscribeAck, from its immediate response if that carries the ack
+// and otherwise from the connect channel.
+func (c *Client) awaitSubscribeAck(ctx context.Context, req *message.BayeuxMessage, ack chan *message.BayeuxMessage, respMsgs []message.BayeuxMessage) error {
+	var msg *message.BayeuxMessage
+	for i := range respMsgs {
+		if respMsgs[i].Channel == "/meta/subscribe" && respMsgs[i].ID == req.ID {
+			msg = &respMsgs[i]
+			break
+		}
+	}
+	if msg == nil {
+		var err error
+		if msg, err = receiveSubscribeAck(ctx, ack); err != nil {
+			return err
+		}
+	}
+	if err := c.confirmSubscribe(req, msg); err != nil {
+		return fmt.Errorf("Error on the subscription request: %w", err)
+	}
+	return nil
+}
+
+// receiveSubscribeAck waits, up to subscribeAckTimeout, for the
+// acknowledgement registered with expectSubscribeAck to arrive on the connect
+// channel.
+func receiveSubscribeAck(ctx context.Context, ack chan *message.BayeuxMessage) (*message.BayeuxMessage, error) {
+	timer := time.NewTimer(subscribeAckTimeout)
+	defer timer.Stop()
+	select {
+	case msg := <-ack:
+		return msg, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("Error on the subscription request: no acknowledgement within %s", subscribeAckTimeout)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("Error waiting for the subscription acknowledgement: %w", ctx.Err())
+	}
+}
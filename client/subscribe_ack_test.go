@@ -0,0 +1,78 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestAsyncSubscribeAck(t *testing.T) {
+	var mu sync.Mutex
+	var queued []message.BayeuxMessage
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		req := reqMsgs[0]
+		resp := []message.BayeuxMessage{}
+		mu.Lock()
+		switch req.Channel {
+		case "/meta/subscribe":
+			for _, sub := range reqMsgs {
+				ack := message.BayeuxMessage{Channel: sub.Channel, ID: sub.ID, Subscription: sub.Subscription, Successful: boolPtr(true)}
+				if sub.Subscription == "/denied" {
+					ack.Successful = boolPtr(false)
+					ack.Error = "403::denied"
+				}
+				queued = append(queued, ack)
+			}
+		case "/meta/connect":
+			resp = append(resp, message.BayeuxMessage{Channel: req.Channel, Successful: boolPtr(true)})
+			resp = append(resp, queued...)
+			queued = nil
+		default:
+			resp = append(resp, message.BayeuxMessage{Channel: req.Channel, Successful: boolPtr(true)})
+		}
+		mu.Unlock()
+		if req.Channel == "/meta/connect" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithAsyncSubscribeAck(true))
+	c.clientID = "test-client-id"
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Disconnect()
+
+	if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Errorf("Expected subscribe to resolve from the connect channel, got %v", err)
+	}
+	if _, err := c.Subscribe("/denied", func(msg *message.BayeuxMessage) {}); err == nil {
+		t.Errorf("Expected a deferred unsuccessful ack to fail the subscribe")
+	}
+
+	b := c.Batch()
+	b.Subscribe("/bar", func(msg *message.BayeuxMessage) {})
+	b.Subscribe("/denied", func(msg *message.BayeuxMessage) {})
+	if err := b.Commit(); err == nil || !c.subscriptionConfirmed("/bar") {
+		t.Errorf("Expected only the batched /denied subscribe to fail on its deferred ack, got %v", err)
+	}
+
+	c.callsMu.Lock()
+	pending := len(c.subscribeAcks)
+	c.callsMu.Unlock()
+	if pending != 0 {
+		t.Errorf("Expected no pending subscribe acks, got %d", pending)
+	}
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// messageBatcher accumulates the messages of a SubscribeBatch subscription
+// and hands them to its handler in slices.
+type messageBatcher struct {
+	maxBatch int
+	maxWait  time.Duration
+	handler  func([]*message.BayeuxMessage)
+
+	mu      sync.Mutex
+	pending []*message.BayeuxMessage
+	timer   *time.Timer
+
+	// ready holds the batches taken while a handler call was in progress.
+	// Handler calls may come from dispatch, the maxWait timer or Disconnect;
+	// whichever finds none running delivers every ready batch in turn, so
+	// calls never overlap and a flush never waits on a running handler.
+	ready   [][]*message.BayeuxMessage
+	running bool
+}
+
+// add queues msg, flushing the batch once it holds maxBatch messages and
+// otherwise arming the maxWait timer for the first message of a batch.
+func (b *messageBatcher) add(msg *message.BayeuxMessage) {
+	b.mu.Lock()
+	b.pending = append(b.pending, msg)
+	if len(b.pending) < b.maxBatch {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.maxWait, b.flush)
+		}
+		b.mu.Unlock()
+		return
+	}
+	batch := b.take()
+	b.mu.Unlock()
+	b.run(batch)
+}
+
+// flush hands the pending messages, if any, to the handler.
+func (b *messageBatcher) flush() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	b.run(batch)
+}
+
+// take empties the pending batch and disarms the timer. The caller must hold
+// b.mu.
+func (b *messageBatcher) take() []*message.BayeuxMessage {
+	batch := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return batch
+}
+
+// run hands batch to the handler, or leaves it to the handler call already
+// in progress.
+func (b *messageBatcher) run(batch []*message.BayeuxMessage) {
+	if len(batch) == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.ready = append(b.ready, batch)
+	if b.running {
+		b.mu.Unlock()
+		return
+	}
+	b.running = true
+	b.mu.Unlock()
+
+	drained := false
+	defer func() {
+		// A panicking handler must not leave later batches waiting on it.
+		if !drained {
+			b.mu.Lock()
+			b.running = false
+			b.mu.Unlock()
+		}
+	}()
+	for {
+		b.mu.Lock()
+		if len(b.ready) == 0 {
+			b.running = false
+			drained = true
+			b.mu.Unlock()
+			return
+		}
+		next := b.ready[0]
+		b.ready = b.ready[1:]
+		b.mu.Unlock()
+		b.handler(next)
+	}
+}
+
+// batchSubscription flushes and forgets its batcher when unsubscribed.
+type batchSubscription struct {
+	Subscription
+	c *Client
+	b *messageBatcher
+}
+
+func (s *batchSubscription) Unsubscribe() error {
+	err := s.Subscription.Unsubscribe()
+	s.c.batchersMu.Lock()
+	delete(s.c.batchers, s.b)
+	s.c.batchersMu.Unlock()
+	s.b.flush()
+	return err
+}
+
+// SubscribeBatch subscribes to channel and hands its messages to handler in
+// slices, once maxBatch messages have accumulated or maxWait has passed since
+// the first message of the slice, whichever comes first. Handler calls for a
+// subscription never overlap. Pending messages are flushed on Unsubscribe and
+// on Disconnect.
+func (c *Client) SubscribeBatch(channel string, maxBatch int, maxWait time.Duration, handler func([]*message.BayeuxMessage)) (Subscription, error) {
+	b := &messageBatcher{maxBatch: max(maxBatch, 1), maxWait: maxWait, handler: func(batch []*message.BayeuxMessage) {
+		c.beginHandler()
+		defer c.endHandler()
+		handler(batch)
+	}}
+	sub, err := c.subscribe(context.Background(), channel, nil, func(_ Subscription, msg *message.BayeuxMessage) {
+		b.add(msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.batchersMu.Lock()
+	if c.batchers == nil {
+		c.batchers = make(map[*messageBatcher]struct{})
+	}
+	c.batchers[b] = struct{}{}
+	c.batchersMu.Unlock()
+
+	return &batchSubscription{Subscription: sub, c: c, b: b}, nil
+}
+
+// flushBatches hands every SubscribeBatch subscription's pending messages to
+// its handler.
+func (c *Client) flushBatches() {
+	c.batchersMu.Lock()
+	batchers := make([]*messageBatcher, 0, len(c.batchers))
+	for b := range c.batchers {
+		batchers = append(batchers, b)
+	}
+	c.batchersMu.Unlock()
+
+	for _, b := range batchers {
+		b.flush()
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestSubscribeBatch(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	batches := make(chan []*message.BayeuxMessage, 4)
+	if _, err := c.SubscribeBatch("/foo", 3, 50*time.Millisecond, func(msgs []*message.BayeuxMessage) {
+		batches <- msgs
+	}); err != nil {
+		t.Fatalf("SubscribeBatch failed: %v", err)
+	}
+
+	wait := func(want int) {
+		t.Helper()
+		select {
+		case msgs := <-batches:
+			if len(msgs) != want {
+				t.Errorf("Expected a batch of %d, got %d", want, len(msgs))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Batch of %d not delivered", want)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+	}
+	wait(3)
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+	wait(1)
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+	time.Sleep(10 * time.Millisecond)
+	c.Disconnect()
+	select {
+	case msgs := <-batches:
+		if len(msgs) != 2 {
+			t.Errorf("Expected Disconnect to flush 2 messages, got %d", len(msgs))
+		}
+	case <-time.After(20 * time.Millisecond):
+		t.Fatalf("Expected Disconnect to flush before maxWait")
+	}
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"maps"
+)
+
+// Subscription is a handler registered on a channel by Subscribe.
+type Subscription interface {
+	// Channel returns the channel the handler was registered on.
+	Channel() string
+	// ID returns the handler's id, unique within the client.
+	ID() int
+	// Unsubscribe removes the handler. Removing the channel's last handler
+	// also tells the server to drop the subscription; the handler is gone
+	// even if that request fails. It is safe to call more than once.
+	Unsubscribe() error
+	// Active reports whether the handler is still registered.
+	Active() bool
+	// Metadata returns the metadata given to SubscribeWithMetadata, or nil.
+	// The map must not be modified.
+	Metadata() map[string]string
+}
+
+type subscription struct {
+	c        *Client
+	channel  string
+	id       int
+	metadata map[string]string
+}
+
+func (s *subscription) Channel() string { return s.channel }
+
+func (s *subscription) ID() int { return s.id }
+
+func (s *subscription) Metadata() map[string]string { return s.metadata }
+
+func (s *subscription) Unsubscribe() error {
+	if !s.c.removeHandler(s.channel, s.id) {
+		return nil
+	}
+	return s.c.unsubscribeChannels(context.Background(), []string{s.channel})
+}
+
+func (s *subscription) Active() bool {
+	s.c.handlersMu.RLock()
+	defer s.c.handlersMu.RUnlock()
+	for _, h := range s.c.handlers[s.channel] {
+		if h.id == s.id {
+			return true
+		}
+	}
+	return false
+}
+
+// removeHandler drops the handler with the given id from channel, forgetting
+// the channel in the subscription store once its last handler is gone, and
+// reports whether it was the last. The handler slice is copied rather than
+// filtered in place because dispatch may still be iterating the old one. The
+// removed handler's onRemove hook runs once handlersMu is released.
+func (c *Client) removeHandler(channel string, id int) bool {
+	removed, last := c.unregisterHandler(channel, id)
+	notifyRemoved(removed)
+	return last
+}
+
+// unregisterHandler does the work of removeHandler under handlersMu, except
+// for the onRemove hooks, returning the removed entries.
+func (c *Client) unregisterHandler(channel string, id int) ([]handlerEntry, bool) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	handlers := c.handlers[channel]
+	newHandlers := make([]handlerEntry, 0, len(handlers))
+	var removed []handlerEntry
+	for _, h := range handlers {
+		if h.id != id {
+			newHandlers = append(newHandlers, h)
+		} else {
+			removed = append(removed, h)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, false
+	}
+	c.handlers[channel] = newHandlers
+	c.trackPattern(channel)
+	c.trackWorker(channel)
+	if len(newHandlers) == 0 {
+		c.store.Remove(channel)
+		c.unconfirmSubscription(channel)
+		return removed, true
+	}
+	return removed, false
+}
+
+// notifyRemoved calls the onRemove hooks of handlers that were just removed.
+func notifyRemoved(handlers []handlerEntry) {
+	for _, h := range handlers {
+		if h.onRemove != nil {
+			h.onRemove()
+		}
+	}
+}
+
+// checkSubscriptionLimits reports ErrTooManySubscriptions if registering a
+// handler on channel would exceed WithMaxSubscriptions or WithMaxHandlers.
+// The caller must hold handlersMu.
+func (c *Client) checkSubscriptionLimits(channel string) error {
+	if c.maxSubscriptions <= 0 && c.maxHandlers <= 0 {
+		return nil
+	}
+	channels, handlers := 0, 0
+	for _, entries := range c.handlers {
+		if len(entries) > 0 {
+			channels++
+			handlers += len(entries)
+		}
+	}
+	if c.maxSubscriptions > 0 && len(c.handlers[channel]) == 0 && channels >= c.maxSubscriptions {
+		return fmt.Errorf("Error subscribing to %s: %w (limit of %d channels)", channel, ErrTooManySubscriptions, c.maxSubscriptions)
+	}
+	if c.maxHandlers > 0 && handlers >= c.maxHandlers {
+		return fmt.Errorf("Error subscribing to %s: %w (limit of %d handlers)", channel, ErrTooManySubscriptions, c.maxHandlers)
+	}
+	return nil
+}
+
+// copyMetadata returns a private copy of subscription metadata, or nil for
+// none.
+func copyMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	return maps.Clone(metadata)
+}
@@ -0,0 +1,406 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestSubscriptionHandle(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	sub1, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	sub2, _ := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+
+	if sub1.Channel() != "/foo" {
+		t.Errorf("Expected channel '/foo', got %q", sub1.Channel())
+	}
+	if sub1.ID() == sub2.ID() {
+		t.Errorf("Expected distinct ids, both are %d", sub1.ID())
+	}
+	if !sub1.Active() || !sub2.Active() {
+		t.Fatalf("Expected both subscriptions to be active")
+	}
+
+	if err := sub1.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	if sub1.Active() {
+		t.Errorf("Expected sub1 to be inactive after Unsubscribe")
+	}
+	if !sub2.Active() {
+		t.Errorf("Expected sub2 to stay active")
+	}
+	if err := sub1.Unsubscribe(); err != nil {
+		t.Errorf("Expected a second Unsubscribe to be a no-op, got %v", err)
+	}
+
+	c.UnsubscribeAll()
+	if sub2.Active() {
+		t.Errorf("Expected sub2 to be inactive after UnsubscribeAll")
+	}
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	unsubscribe, err := c.SubscribeFunc("/foo", func(msg *message.BayeuxMessage) {})
+	if err != nil {
+		t.Fatalf("SubscribeFunc failed: %v", err)
+	}
+	unsubscribe()
+
+	c.handlersMu.RLock()
+	count := len(c.handlers["/foo"])
+	c.handlersMu.RUnlock()
+	if count != 0 {
+		t.Errorf("Expected the handler to be removed, got %d", count)
+	}
+}
+
+func TestSubscribeEx(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	type delivery struct {
+		pattern, channel string
+	}
+	got := make(chan delivery, 1)
+	sub, err := c.SubscribeEx("/events", func(sub Subscription, msg *message.BayeuxMessage) {
+		got <- delivery{sub.Channel(), msg.Channel}
+	})
+	if err != nil {
+		t.Fatalf("SubscribeEx failed: %v", err)
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/events"})
+	d := <-got
+	if d.pattern != sub.Channel() || d.channel != "/events" {
+		t.Errorf("Expected handler to see its subscription and the message channel, got %+v", d)
+	}
+}
+
+func TestWaitForSubscription(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		resp := []message.BayeuxMessage{{
+			Channel:      reqMsgs[0].Channel,
+			ClientID:     "test-client-id",
+			Successful:   boolPtr(true),
+			Subscription: reqMsgs[0].Subscription,
+		}}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	waited := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		waited <- c.WaitForSubscription(ctx, "/foo")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := <-waited; err != nil {
+		t.Errorf("Expected the wait to end on confirmation, got %v", err)
+	}
+	if err := c.WaitForSubscription(context.Background(), "/foo"); err != nil {
+		t.Errorf("Expected a confirmed subscription to return at once, got %v", err)
+	}
+
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.WaitForSubscription(ctx, "/foo"); err == nil {
+		t.Errorf("Expected a new session to need the subscription confirmed again")
+	}
+}
+
+func TestDedupServerSubscribe(t *testing.T) {
+	subscribes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscribes++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/subscribe","successful":true}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithDedupServerSubscribe(true))
+	c.clientID = "test-client-id"
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+	}
+	if subscribes != 1 {
+		t.Errorf("Expected a single /meta/subscribe, got %d", subscribes)
+	}
+	c.handlersMu.RLock()
+	n := len(c.handlers["/foo"])
+	c.handlersMu.RUnlock()
+	if n != 2 {
+		t.Errorf("Expected both handlers to be registered, got %d", n)
+	}
+}
+
+func TestSubscriptionLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/subscribe","successful":true}]`))
+	}))
+	defer server.Close()
+
+	handler := func(msg *message.BayeuxMessage) {}
+	c := NewClient(server.URL, WithMaxSubscriptions(1))
+	c.clientID = "test-client-id"
+	if _, err := c.Subscribe("/foo", handler); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if _, err := c.Subscribe("/foo", handler); err != nil {
+		t.Errorf("Expected another handler on /foo to be accepted, got %v", err)
+	}
+	if _, err := c.Subscribe("/bar", handler); !errors.Is(err, ErrTooManySubscriptions) {
+		t.Errorf("Expected a second channel to exceed the limit, got %v", err)
+	}
+
+	c = NewClient(server.URL, WithMaxHandlers(1))
+	c.clientID = "test-client-id"
+	sub, err := c.Subscribe("/foo", handler)
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if _, err := c.Subscribe("/foo", handler); !errors.Is(err, ErrTooManySubscriptions) {
+		t.Errorf("Expected a second handler to exceed the limit, got %v", err)
+	}
+	sub.Unsubscribe()
+	if _, err := c.Subscribe("/bar", handler); err != nil {
+		t.Errorf("Expected room after Unsubscribe, got %v", err)
+	}
+}
+
+func TestSubscribeConfirmer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{
+			Channel:      "/meta/subscribe",
+			Subscription: reqMsgs[0].Subscription,
+			Data:         map[string]interface{}{"status": "ok"},
+		}})
+	}))
+	defer server.Close()
+
+	errRefused := errors.New("refused")
+	c := NewClient(server.URL, WithSubscribeConfirmer(func(request, response *message.BayeuxMessage) (bool, error) {
+		if request.Subscription == "/refused" {
+			return false, errRefused
+		}
+		return response.Data["status"] == "ok", nil
+	}))
+	c.clientID = "test-client-id"
+
+	if _, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err != nil {
+		t.Fatalf("Expected the confirmer to accept the subscribe, got %v", err)
+	}
+	if _, err := c.Subscribe("/refused", func(msg *message.BayeuxMessage) {}); !errors.Is(err, errRefused) {
+		t.Errorf("Expected the confirmer's error, got %v", err)
+	}
+
+	plain := NewClient(server.URL)
+	plain.clientID = "test-client-id"
+	if _, err := plain.Subscribe("/foo", func(msg *message.BayeuxMessage) {}); err == nil {
+		t.Errorf("Expected an ack without successful to fail by default")
+	}
+}
+
+func TestSubscribeWithMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/subscribe","successful":true}]`))
+	}))
+	defer server.Close()
+
+	out := &syncBuffer{}
+	c := NewClient(server.URL, WithErrorWriter(out))
+	c.clientID = "test-client-id"
+
+	metadata := map[string]string{"feature": "billing", "team": "payments"}
+	done := make(chan struct{})
+	sub, err := c.SubscribeWithMetadata("/foo", metadata, func(msg *message.BayeuxMessage) {
+		defer close(done)
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatalf("SubscribeWithMetadata failed: %v", err)
+	}
+	metadata["feature"] = "changed"
+	if got := sub.Metadata(); got["feature"] != "billing" || got["team"] != "payments" {
+		t.Errorf("Expected the metadata given at subscribe time, got %v", got)
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo"})
+	<-done
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "panic") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := out.String(); !strings.Contains(got, "panic channel=/foo feature=billing team=payments: boom") {
+		t.Errorf("Expected the panic line to carry the metadata, got %q", got)
+	}
+}
+
+func TestUnhandledAfterUnsubscribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: reqMsgs[0].Channel, Subscription: reqMsgs[0].Subscription, Successful: boolPtr(true)}})
+	}))
+	defer server.Close()
+
+	unhandled := make(chan *message.BayeuxMessage, 1)
+	c := NewClient(server.URL, OnUnhandledMessage(func(msg *message.BayeuxMessage) {
+		unhandled <- msg
+	}))
+	c.clientID = "test-client-id"
+
+	handled := make(chan struct{}, 1)
+	sub, err := c.Subscribe("/foo", func(msg *message.BayeuxMessage) { handled <- struct{}{} })
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/foo", Data: map[string]interface{}{"n": 1}})
+	select {
+	case msg := <-unhandled:
+		if msg.Channel != "/foo" {
+			t.Errorf("Expected the /foo message, got %s", msg.Channel)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the late message to reach OnUnhandledMessage")
+	}
+	select {
+	case <-handled:
+		t.Errorf("Expected the removed handler not to be called")
+	default:
+	}
+}
+
+func TestSubscribeUntil(t *testing.T) {
+	unsubscribed := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		if reqMsgs[0].Channel == "/meta/unsubscribe" {
+			unsubscribed <- reqMsgs[0].Subscription
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: reqMsgs[0].Channel, Subscription: reqMsgs[0].Subscription, Successful: boolPtr(true)}})
+	}))
+	defer server.Close()
+
+	errs := make(chan error, 1)
+	c := NewClient(server.URL, WithErrorHandler(func(err error) { errs <- err }))
+	c.clientID = "test-client-id"
+
+	done := make(chan int, 3)
+	sub, err := c.SubscribeUntil("/steps", func(msg *message.BayeuxMessage) error {
+		n := int(msg.Data["n"].(float64))
+		done <- n
+		switch n {
+		case 1:
+			return errors.New("step failed")
+		case 2:
+			return fmt.Errorf("finished: %w", ErrStopSubscription)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SubscribeUntil failed: %v", err)
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/steps", Data: map[string]interface{}{"n": 1.0}})
+	<-done
+	if err := <-errs; err == nil || err.Error() != "step failed" {
+		t.Errorf("Expected the handler's error to be reported, got %v", err)
+	}
+	if !sub.Active() {
+		t.Errorf("Expected an ordinary error to keep the subscription")
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/steps", Data: map[string]interface{}{"n": 2.0}})
+	<-done
+	select {
+	case channel := <-unsubscribed:
+		if channel != "/steps" {
+			t.Errorf("Expected /steps to be unsubscribed, got %s", channel)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected ErrStopSubscription to unsubscribe the channel")
+	}
+	if sub.Active() {
+		t.Errorf("Expected the handler to be removed")
+	}
+}
+
+func TestFailedSubscribeLeavesNoHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: reqMsgs[0].Channel, Subscription: reqMsgs[0].Subscription, Successful: boolPtr(false), Error: "403::denied"}})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithMaxSubscriptions(1))
+	c.clientID = "test-client-id"
+
+	for _, channel := range []string{"/foo", "/bar"} {
+		if _, err := c.Subscribe(channel, func(msg *message.BayeuxMessage) {}); err == nil || errors.Is(err, ErrTooManySubscriptions) {
+			t.Errorf("Expected the server to reject %s, got %v", channel, err)
+		}
+	}
+	if c.hasHandlers("/foo") || c.hasHandlers("/bar") {
+		t.Errorf("Expected no handler to stay registered after a failed subscribe")
+	}
+	if got := c.store.List(); len(got) != 0 {
+		t.Errorf("Expected nothing left to resubscribe, got %v", got)
+	}
+}
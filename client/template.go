@@ -0,0 +1,121 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// ChannelTemplate describes a family of channels sharing a naming convention,
+// such as "/user/{id}/notifications", where every "{name}" segment is a
+// parameter filled in by Build and recovered by Extract.
+type ChannelTemplate struct {
+	pattern  string
+	segments []string
+}
+
+// NewChannelTemplate parses pattern into a ChannelTemplate. The pattern must
+// be an absolute channel whose parameters each take up a whole segment and
+// have distinct names.
+func NewChannelTemplate(pattern string) (*ChannelTemplate, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("invalid channel template %q: must start with /", pattern)
+	}
+	segments := strings.Split(pattern[1:], "/")
+	seen := make(map[string]bool)
+	for _, seg := range segments {
+		if seg == "" {
+			return nil, fmt.Errorf("invalid channel template %q: empty segment", pattern)
+		}
+		name, ok := templateParam(seg)
+		if !ok {
+			if strings.ContainsAny(seg, "{}") {
+				return nil, fmt.Errorf("invalid channel template %q: parameter %q must be a whole segment", pattern, seg)
+			}
+			continue
+		}
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("invalid channel template %q: empty or repeated parameter %q", pattern, seg)
+		}
+		seen[name] = true
+	}
+	return &ChannelTemplate{pattern: pattern, segments: segments}, nil
+}
+
+// templateParam returns the parameter name of a "{name}" segment.
+func templateParam(seg string) (string, bool) {
+	if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+		return "", false
+	}
+	return seg[1 : len(seg)-1], true
+}
+
+// String returns the template's pattern.
+func (t *ChannelTemplate) String() string { return t.pattern }
+
+// Build returns the concrete channel for params. Every parameter must be given
+// a non-empty value that is a single segment and no wildcard.
+func (t *ChannelTemplate) Build(params map[string]string) (string, error) {
+	var b strings.Builder
+	for _, seg := range t.segments {
+		b.WriteByte('/')
+		name, ok := templateParam(seg)
+		if !ok {
+			b.WriteString(seg)
+			continue
+		}
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("Error building channel from %s: missing parameter %q", t.pattern, name)
+		}
+		if value == "" || value == "*" || value == "**" || strings.Contains(value, "/") {
+			return "", fmt.Errorf("Error building channel from %s: invalid value %q for parameter %q", t.pattern, value, name)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+// Extract parses a concrete channel of the family back into its parameters.
+// It reports false if channel does not follow the template.
+func (t *ChannelTemplate) Extract(channel string) (map[string]string, bool) {
+	rest, ok := strings.CutPrefix(channel, "/")
+	if !ok {
+		return nil, false
+	}
+	segments := strings.Split(rest, "/")
+	if len(segments) != len(t.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, seg := range t.segments {
+		if name, ok := templateParam(seg); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[name] = segments[i]
+		} else if segments[i] != seg {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// SubscribeTemplate subscribes to the channel t builds from params. The
+// handler receives the parameters extracted from each message's channel,
+// which are params themselves unless a custom ChannelMatcher delivers
+// messages from other channels of the family.
+func (c *Client) SubscribeTemplate(t *ChannelTemplate, params map[string]string, handler func(params map[string]string, msg *message.BayeuxMessage)) (Subscription, error) {
+	channel, err := t.Build(params)
+	if err != nil {
+		return nil, err
+	}
+	return c.SubscribeEx(channel, func(_ Subscription, msg *message.BayeuxMessage) {
+		got, ok := t.Extract(msg.Channel)
+		if !ok {
+			got = params
+		}
+		handler(got, msg)
+	})
+}
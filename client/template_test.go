@@ -0,0 +1,76 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestChannelTemplate(t *testing.T) {
+	tmpl, err := NewChannelTemplate("/user/{id}/notifications")
+	if err != nil {
+		t.Fatalf("NewChannelTemplate failed: %v", err)
+	}
+
+	channel, err := tmpl.Build(map[string]string{"id": "42"})
+	if err != nil || channel != "/user/42/notifications" {
+		t.Errorf("Expected /user/42/notifications, got %q, %v", channel, err)
+	}
+	if _, err := tmpl.Build(nil); err == nil {
+		t.Errorf("Expected a missing parameter to fail")
+	}
+	if _, err := tmpl.Build(map[string]string{"id": "a/b"}); err == nil {
+		t.Errorf("Expected a multi-segment value to fail")
+	}
+
+	params, ok := tmpl.Extract("/user/7/notifications")
+	if !ok || !reflect.DeepEqual(params, map[string]string{"id": "7"}) {
+		t.Errorf("Expected id 7 to be extracted, got %v, %v", params, ok)
+	}
+	if _, ok := tmpl.Extract("/user/7/messages"); ok {
+		t.Errorf("Expected a channel outside the family not to match")
+	}
+
+	for _, bad := range []string{"user/{id}", "/user/x{id}", "/{a}/{a}", "/user//x"} {
+		if _, err := NewChannelTemplate(bad); err == nil {
+			t.Errorf("Expected template %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSubscribeTemplate(t *testing.T) {
+	var subscribed string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+		subscribed = reqMsgs[0].Subscription
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{{Channel: "/meta/subscribe", Successful: boolPtr(true)}})
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	tmpl, _ := NewChannelTemplate("/user/{id}/notifications")
+	got := make(chan map[string]string, 1)
+	_, err := c.SubscribeTemplate(tmpl, map[string]string{"id": "42"}, func(params map[string]string, msg *message.BayeuxMessage) {
+		got <- params
+	})
+	if err != nil {
+		t.Fatalf("SubscribeTemplate failed: %v", err)
+	}
+	if subscribed != "/user/42/notifications" {
+		t.Errorf("Expected subscription to /user/42/notifications, got %q", subscribed)
+	}
+
+	c.dispatch(&message.BayeuxMessage{Channel: "/user/42/notifications"})
+	if params := <-got; params["id"] != "42" {
+		t.Errorf("Expected the handler to get id 42, got %v", params)
+	}
+}
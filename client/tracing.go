@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer starts spans around Bayeux operations, so they show up in a trace
+// alongside the caller's other work. It is a small hook rather than a
+// dependency on a tracing library; an adapter for OpenTelemetry or similar is
+// a few lines.
+type Tracer interface {
+	// StartSpan begins a child span of ctx for operation ("handshake",
+	// "subscribe", "publish", "connect", "unsubscribe" or "disconnect") on
+	// channel, by the session clientID, which is empty before the handshake.
+	StartSpan(ctx context.Context, operation, channel, clientID string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// Inject adds the span's trace propagation headers to an outgoing
+	// request.
+	Inject(header http.Header)
+	// End finishes the span. err is nil on success; a server rejection is a
+	// *ServerError carrying the Bayeux error code.
+	End(err error)
+}
+
+type spanKey struct{}
+
+type noopSpan struct{}
+
+func (noopSpan) Inject(http.Header) {}
+func (noopSpan) End(error)          {}
+
+// startSpan starts a span for operation with the WithTracer tracer, or a
+// no-op span without one. The span rides in the returned context so the send
+// path can inject its headers.
+func (c *Client) startSpan(ctx context.Context, operation, channel string) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	ctx, span := c.tracer.StartSpan(ctx, operation, channel, c.getClientID())
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// injectSpan adds the propagation headers of the span carried by ctx, if any.
+func injectSpan(ctx context.Context, header http.Header) {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		span.Inject(header)
+	}
+}
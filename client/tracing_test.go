@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+type recordedSpan struct {
+	operation, channel string
+	err                error
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, operation, channel, clientID string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{operation: operation, channel: channel}
+	t.spans = append(t.spans, span)
+	return ctx, &testSpan{span: span}
+}
+
+type testSpan struct{ span *recordedSpan }
+
+func (s *testSpan) Inject(header http.Header) { header.Set("Traceparent", s.span.operation) }
+func (s *testSpan) End(err error)             { s.span.err = err }
+
+func TestTracer(t *testing.T) {
+	var traceparents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get("Traceparent"))
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		ack := message.BayeuxMessage{Channel: reqMsgs[0].Channel, ClientID: "test-client-id", Successful: boolPtr(true)}
+		if reqMsgs[0].Channel == "/denied" {
+			ack.Successful = boolPtr(false)
+			ack.Error = "403::denied"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]message.BayeuxMessage{ack})
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	c := NewClient(server.URL, WithTracer(tracer))
+	if err := c.Handshake(); err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	c.Publish("/foo", map[string]interface{}{"n": 1})
+	c.Publish("/denied", map[string]interface{}{"n": 1})
+
+	if want := []string{"handshake", "publish", "publish"}; !reflect.DeepEqual(traceparents, want) {
+		t.Errorf("Expected propagation headers %v, got %v", want, traceparents)
+	}
+	if len(tracer.spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(tracer.spans))
+	}
+	if s := tracer.spans[1]; s.channel != "/foo" || s.err != nil {
+		t.Errorf("Expected a successful /foo publish span, got %+v", s)
+	}
+	var serverErr *ServerError
+	if s := tracer.spans[2]; !errors.As(s.err, &serverErr) || serverErr.Code != 403 {
+		t.Errorf("Expected the /denied span to end with code 403, got %+v", s)
+	}
+}
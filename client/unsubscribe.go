@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// Unsubscribe removes every handler registered on channel and tells the
+// server to drop the subscription. The handlers are removed even if the
+// server request fails. Nothing is sent when channel has no handlers.
+func (c *Client) Unsubscribe(channel string) error {
+	return c.unsubscribeChannels(context.Background(), c.dropHandlers([]string{channel}))
+}
+
+// UnsubscribeAll removes every registered handler and tells the server to
+// drop all of the client's subscriptions in a single batched request. Local
+// handlers are removed even if the server request fails; the returned error
+// joins the failures of the individual channels. It is safe to call while
+// the connect loop is running.
+func (c *Client) UnsubscribeAll() error {
+	c.handlersMu.RLock()
+	channels := make([]string, 0, len(c.handlers))
+	for ch := range c.handlers {
+		channels = append(channels, ch)
+	}
+	c.handlersMu.RUnlock()
+
+	return c.unsubscribeChannels(context.Background(), c.dropHandlers(channels))
+}
+
+// dropHandlers removes every handler registered on channels and returns, in
+// sorted order, the channels that had at least one.
+func (c *Client) dropHandlers(channels []string) []string {
+	c.handlersMu.Lock()
+	dropped := make([]string, 0, len(channels))
+	var removed []handlerEntry
+	for _, ch := range channels {
+		if len(c.handlers[ch]) > 0 {
+			dropped = append(dropped, ch)
+			removed = append(removed, c.handlers[ch]...)
+		}
+		delete(c.handlers, ch)
+		c.trackPattern(ch)
+		c.trackWorker(ch)
+	}
+	c.handlersMu.Unlock()
+	notifyRemoved(removed)
+
+	sort.Strings(dropped)
+	for _, ch := range dropped {
+		c.store.Remove(ch)
+		c.unconfirmSubscription(ch)
+	}
+	return dropped
+}
+
+// unsubscribeChannels sends one /meta/unsubscribe per channel in a single
+// batch and joins the per-channel failures.
+func (c *Client) unsubscribeChannels(ctx context.Context, channels []string) (err error) {
+	if len(channels) == 0 {
+		return nil
+	}
+	ctx, span := c.startSpan(ctx, "unsubscribe", "/meta/unsubscribe")
+	defer func() { span.End(err) }()
+
+	reqMsgs := make([]extMessage, len(channels))
+	for i, ch := range channels {
+		reqMsgs[i] = extMessage{BayeuxMessage: c.unsubscribeMessage(ch), Ext: c.outgoingExt(nil)}
+		if err := c.prepareOutgoing(&reqMsgs[i].BayeuxMessage); err != nil {
+			return fmt.Errorf("Error on the unsubscribe request: %w", err)
+		}
+	}
+
+	reqBody, err := json.Marshal(reqMsgs)
+	if err != nil {
+		return fmt.Errorf("Error during request marshal: %w", err)
+	}
+
+	resp, err := c.post(ctx, reqBody)
+	if err != nil {
+		return fmt.Errorf("Error on the unsubscribe request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var respMsgs []message.BayeuxMessage
+	if err := c.decode(resp.Body, &respMsgs); err != nil {
+		return fmt.Errorf("Error decoding the message: %w", err)
+	}
+
+	acks := make(map[string]*message.BayeuxMessage, len(respMsgs))
+	for i := range respMsgs {
+		if respMsgs[i].Channel == "/meta/unsubscribe" {
+			acks[respMsgs[i].Subscription] = &respMsgs[i]
+		}
+	}
+
+	var errs []error
+	for _, ch := range channels {
+		ack, ok := acks[ch]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("Error unsubscribing from %s: %w", ch, errEmptyResponse))
+		case !c.succeeded(ack):
+			errs = append(errs, fmt.Errorf("Error unsubscribing from %s: %w", ch, newServerError(ack)))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// newAckServer answers every message of a batch with a successful ack on the
+// same channel, except for subscriptions to /denied, and records unsubscribe
+// batches.
+func newAckServer(unsubscribes *[][]message.BayeuxMessage) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqMsgs []message.BayeuxMessage
+		_ = json.NewDecoder(r.Body).Decode(&reqMsgs)
+
+		resp := make([]message.BayeuxMessage, 0, len(reqMsgs))
+		for _, req := range reqMsgs {
+			ack := message.BayeuxMessage{
+				Channel:      req.Channel,
+				Successful:   boolPtr(true),
+				Subscription: req.Subscription,
+			}
+			if req.Subscription == "/denied" && req.Channel == "/meta/unsubscribe" {
+				ack.Successful = boolPtr(false)
+				ack.Error = "403::denied"
+			}
+			resp = append(resp, ack)
+		}
+		if len(reqMsgs) > 0 && reqMsgs[0].Channel == "/meta/unsubscribe" && unsubscribes != nil {
+			mu.Lock()
+			*unsubscribes = append(*unsubscribes, reqMsgs)
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestUnsubscribeAll(t *testing.T) {
+	var batches [][]message.BayeuxMessage
+	server := newAckServer(&batches)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	c.Subscribe("/bar", func(msg *message.BayeuxMessage) {})
+
+	if err := c.UnsubscribeAll(); err != nil {
+		t.Fatalf("UnsubscribeAll failed: %v", err)
+	}
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("Expected one batch of 2 unsubscribes, got %v", batches)
+	}
+
+	c.handlersMu.RLock()
+	count := len(c.handlers)
+	c.handlersMu.RUnlock()
+	if count != 0 {
+		t.Errorf("Expected no handlers after UnsubscribeAll, got %d channels", count)
+	}
+	if got := c.store.List(); len(got) != 0 {
+		t.Errorf("Expected an empty subscription store, got %v", got)
+	}
+}
+
+func TestUnsubscribeAllPartialFailure(t *testing.T) {
+	server := newAckServer(nil)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	c.Subscribe("/denied", func(msg *message.BayeuxMessage) {})
+
+	err := c.UnsubscribeAll()
+	if err == nil || !strings.Contains(err.Error(), "/denied") || strings.Contains(err.Error(), "/foo") {
+		t.Fatalf("Expected an error naming only /denied, got %v", err)
+	}
+
+	c.handlersMu.RLock()
+	count := len(c.handlers)
+	c.handlersMu.RUnlock()
+	if count != 0 {
+		t.Errorf("Expected local handlers to be removed despite the failure, got %d channels", count)
+	}
+}
+
+func TestUnsubscribeLastHandler(t *testing.T) {
+	var batches [][]message.BayeuxMessage
+	server := newAckServer(&batches)
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.clientID = "test-client-id"
+
+	sub1, _ := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	sub2, _ := c.Subscribe("/foo", func(msg *message.BayeuxMessage) {})
+	if err := sub1.Unsubscribe(); err != nil || len(batches) != 0 {
+		t.Fatalf("Expected nothing to be sent while /foo has a handler left, got %v, %v", err, batches)
+	}
+	if err := sub2.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	if len(batches) != 1 || batches[0][0].Subscription != "/foo" {
+		t.Fatalf("Expected /meta/unsubscribe for /foo once its last handler was removed, got %v", batches)
+	}
+	if err := sub2.Unsubscribe(); err != nil || len(batches) != 1 {
+		t.Errorf("Expected a repeated Unsubscribe to send nothing, got %v, %v", err, batches)
+	}
+
+	c.Subscribe("/denied", func(msg *message.BayeuxMessage) {})
+	c.Subscribe("/denied", func(msg *message.BayeuxMessage) {})
+	if err := c.Unsubscribe("/denied"); err == nil {
+		t.Errorf("Expected the server's refusal to be reported")
+	}
+	c.handlersMu.RLock()
+	left := len(c.handlers["/denied"])
+	c.handlersMu.RUnlock()
+	if left != 0 {
+		t.Errorf("Expected the handlers to be removed despite the failure, got %d", left)
+	}
+	if err := c.Unsubscribe("/unknown"); err != nil || len(batches) != 2 {
+		t.Errorf("Expected nothing to be sent for a channel without handlers, got %v, %d batches", err, len(batches))
+	}
+}
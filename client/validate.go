@@ -0,0 +1,98 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ValidateConfig checks the client's configuration without sending anything:
+// the option errors every request would otherwise fail with, the server URLs
+// against the long-polling transport, and the names of the channels already
+// known to the client, from registered handlers, the subscription store and
+// channel options such as WithChannelQueue. The returned error joins every
+// problem found.
+func (c *Client) ValidateConfig() error {
+	var errs []error
+	if c.optErr != nil {
+		errs = append(errs, fmt.Errorf("invalid client option: %w", c.optErr))
+	}
+
+	urls := c.serverURLs
+	if len(urls) == 0 {
+		urls = []string{c.serverURL}
+	}
+	for _, u := range urls {
+		if err := validateServerURL(u); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, channel := range c.knownChannels() {
+		if err := validateChannel(channel); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateServerURL checks that raw is an absolute URL the long-polling
+// transport can reach.
+func validateServerURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid server URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid server URL %q: scheme %q is not supported by the long-polling transport", raw, u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid server URL %q: no host", raw)
+	}
+	return nil
+}
+
+// knownChannels returns, sorted and without duplicates, the channels named by
+// registered handlers, the subscription store and channel options.
+func (c *Client) knownChannels() []string {
+	var channels []string
+	c.handlersMu.RLock()
+	for channel := range c.handlers {
+		channels = append(channels, channel)
+	}
+	c.handlersMu.RUnlock()
+	channels = append(channels, c.store.List()...)
+	for channel := range c.channelQueues {
+		channels = append(channels, channel)
+	}
+	for channel := range c.sequenceFields {
+		channels = append(channels, channel)
+	}
+	slices.Sort(channels)
+	return slices.Compact(channels)
+}
+
+// validateChannel checks that channel is an absolute channel name without
+// empty segments, whose only wildcard, if any, is a whole last segment.
+func validateChannel(channel string) error {
+	rest, ok := strings.CutPrefix(channel, "/")
+	if !ok {
+		return fmt.Errorf("invalid channel %q: must start with /", channel)
+	}
+	segments := strings.Split(rest, "/")
+	for i, seg := range segments {
+		switch {
+		case seg == "":
+			return fmt.Errorf("invalid channel %q: empty segment", channel)
+		case seg == "*" || seg == "**":
+			if i != len(segments)-1 {
+				return fmt.Errorf("invalid channel %q: wildcard before the last segment", channel)
+			}
+		case strings.Contains(seg, "*"):
+			return fmt.Errorf("invalid channel %q: wildcard must be a whole segment", channel)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestValidateConfig(t *testing.T) {
+	c := NewClient("http://bayeux.example/cometd", WithChannelQueue("/queued/*", 4, DropOldest))
+	c.handlers["/foo/**"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) {}}}
+	if err := c.ValidateConfig(); err != nil {
+		t.Errorf("Expected a valid configuration, got %v", err)
+	}
+
+	bad := NewClient("ws://bayeux.example/cometd",
+		WithHTTPClient(&http.Client{}),
+		WithTLSHandshakeTimeout(time.Second),
+		WithChannelQueue("/a/*/b", 4, DropOldest),
+	)
+	bad.store.Add("no-slash")
+	err := bad.ValidateConfig()
+	if err == nil {
+		t.Fatalf("Expected the configuration to be rejected")
+	}
+	for _, want := range []string{"WithHTTPClient", `scheme "ws"`, `"/a/*/b"`, `"no-slash"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to report %s, got %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// BayeuxVersion is the protocol version the client sends in its handshake.
+const BayeuxVersion = "1.0"
+
+// VersionMismatchError reports a handshake the server rejected because the
+// client's protocol version is below the server's minimum.
+type VersionMismatchError struct {
+	ClientVersion string
+	ServerMinimum string
+
+	err error
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("Error on the handshake: client protocol version %s is below the server minimum %s, upgrade required", e.ClientVersion, e.ServerMinimum)
+}
+
+// Unwrap returns the ServerError of the rejected handshake.
+func (e *VersionMismatchError) Unwrap() error { return e.err }
+
+// handshakeVersions holds the version fields of a handshake response, which
+// the message package does not model.
+type handshakeVersions struct {
+	Version        string `json:"version"`
+	MinimumVersion string `json:"minimumVersion"`
+}
+
+// versionMismatch returns a VersionMismatchError for the rejected handshake
+// ack when raw, the response body, carries a minimumVersion above
+// BayeuxVersion, and nil otherwise.
+func (c *Client) versionMismatch(raw []byte, ack *message.BayeuxMessage) error {
+	if c.responseUnwrapper != nil {
+		var err error
+		if raw, err = c.responseUnwrapper(raw); err != nil {
+			return nil
+		}
+	}
+	var versions []handshakeVersions
+	if err := json.Unmarshal(raw, &versions); err != nil || len(versions) == 0 {
+		return nil
+	}
+	minimum := versions[0].MinimumVersion
+	if minimum == "" || compareVersions(BayeuxVersion, minimum) >= 0 {
+		return nil
+	}
+	return &VersionMismatchError{ClientVersion: BayeuxVersion, ServerMinimum: minimum, err: newServerError(ack)}
+}
+
+// compareVersions compares two dotted numeric versions, returning -1, 0 or 1.
+// Missing components count as zero and non-numeric ones as their numeric
+// prefix.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		x, y := versionComponent(as, i), versionComponent(bs, i)
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionComponent(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	digits := strings.TrimRightFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' })
+	n, _ := strconv.Atoi(digits)
+	return n
+}
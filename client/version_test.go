@@ -0,0 +1,48 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"channel":"/meta/handshake","successful":false,"error":"400::unsupported version","version":"2.1","minimumVersion":"2.0"}]`))
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	err := c.Handshake()
+	var mismatch *VersionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected a VersionMismatchError, got %v", err)
+	}
+	if mismatch.ClientVersion != BayeuxVersion || mismatch.ServerMinimum != "2.0" {
+		t.Errorf("Expected client %s against minimum 2.0, got %+v", BayeuxVersion, mismatch)
+	}
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Code != 400 {
+		t.Errorf("Expected the server error to stay reachable, got %v", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1", 0},
+		{"1.0", "2.0", -1},
+		{"1.10", "1.9", 1},
+		{"1.0beta", "1.0", 0},
+	}
+	for _, tc := range cases {
+		if got := compareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Warmup opens a connection to the server, completing the TCP and TLS
+// handshakes, and leaves it in the HTTP client's idle pool so the Bayeux
+// handshake that follows does not pay for connection setup. It sends a HEAD
+// request, which Bayeux servers ignore; any HTTP status counts as success.
+// The connection only survives if the server and the transport keep idle
+// connections alive.
+func (c *Client) Warmup(ctx context.Context) error {
+	if c.optErr != nil {
+		return fmt.Errorf("invalid client option: %w", c.optErr)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.ServerURL(), nil)
+	if err != nil {
+		return fmt.Errorf("Error on the warmup request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error on the warmup request: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
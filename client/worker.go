@@ -0,0 +1,105 @@
+package client
+
+import (
+	"sync"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+// channelWorker is the long-lived goroutine that runs the handlers of one
+// registered channel under WithPerChannelWorker, one message at a time. Its
+// queue is unbounded so that a slow channel never holds up dispatch.
+type channelWorker struct {
+	mu      sync.Mutex
+	ready   *sync.Cond
+	items   []workerMessage
+	stopped bool
+}
+
+// workerMessage is a message queued for a channel worker with the handlers of
+// that channel. total counts the handlers it was dispatched to across every
+// worker, which decides whether each needs a private copy.
+type workerMessage struct {
+	msg      *message.BayeuxMessage
+	handlers []handlerEntry
+	total    int
+}
+
+func newChannelWorker(c *Client) *channelWorker {
+	w := &channelWorker{}
+	w.ready = sync.NewCond(&w.mu)
+	go w.run(c)
+	return w
+}
+
+// push queues a message for the worker.
+func (w *channelWorker) push(m workerMessage) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.items = append(w.items, m)
+	w.ready.Signal()
+}
+
+// stop makes the worker exit once it has delivered what is already queued.
+func (w *channelWorker) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	w.ready.Signal()
+}
+
+func (w *channelWorker) run(c *Client) {
+	for {
+		w.mu.Lock()
+		for len(w.items) == 0 && !w.stopped {
+			w.ready.Wait()
+		}
+		if len(w.items) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		m := w.items[0]
+		w.items = w.items[1:]
+		w.mu.Unlock()
+
+		for _, entry := range m.handlers {
+			c.invokeWithin(entry, handlerCopy(m.msg, m.total))
+		}
+	}
+}
+
+// trackWorker starts the worker of channel when it gets its first handler
+// and stops it when its last one is removed. The caller must hold handlersMu
+// for writing.
+func (c *Client) trackWorker(channel string) {
+	if !c.perChannelWorker {
+		return
+	}
+	w, ok := c.workers[channel]
+	switch {
+	case len(c.handlers[channel]) > 0 && !ok:
+		c.workers[channel] = newChannelWorker(c)
+	case len(c.handlers[channel]) == 0 && ok:
+		w.stop()
+		delete(c.workers, channel)
+	}
+}
+
+// dispatchToWorkers hands msg to the worker of its exact channel and of
+// every pattern matching it, each with that channel's handlers. n is the
+// total number of handlers msg goes to.
+func (c *Client) dispatchToWorkers(msg *message.BayeuxMessage, n int) {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+	if w, ok := c.workers[msg.Channel]; ok {
+		w.push(workerMessage{msg: msg, handlers: c.handlers[msg.Channel], total: n})
+	}
+	for _, pattern := range c.patterns {
+		if pattern == msg.Channel || !c.matches(pattern, msg.Channel) {
+			continue
+		}
+		if w, ok := c.workers[pattern]; ok {
+			w.push(workerMessage{msg: msg, handlers: c.handlers[pattern], total: n})
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/charlinchui/galliard/message"
+)
+
+func TestPerChannelWorker(t *testing.T) {
+	c := NewClient("http://example.com/bayeux", WithPerChannelWorker(true))
+	got := make(chan int, 10)
+	slow := make(chan string, 10)
+
+	c.handlersMu.Lock()
+	c.handlers["/foo"] = []handlerEntry{{id: 1, handler: func(msg *message.BayeuxMessage) {
+		time.Sleep(5 * time.Millisecond)
+		got <- msg.Data["n"].(int)
+	}}}
+	c.handlers["/bar"] = []handlerEntry{{id: 2, handler: func(msg *message.BayeuxMessage) {
+		slow <- msg.Channel
+	}}}
+	c.trackWorker("/foo")
+	c.trackWorker("/bar")
+	c.handlersMu.Unlock()
+
+	for n := 0; n < 5; n++ {
+		c.dispatch(&message.BayeuxMessage{Channel: "/foo", Data: map[string]interface{}{"n": n}})
+	}
+	c.dispatch(&message.BayeuxMessage{Channel: "/bar"})
+	select {
+	case <-slow:
+	case <-time.After(20 * time.Millisecond):
+		t.Errorf("Expected /bar to be handled while /foo is busy")
+	}
+
+	var order []int
+	for range 5 {
+		order = append(order, <-got)
+	}
+	if want := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected per-channel order %v, got %v", want, order)
+	}
+
+	c.removeHandler("/foo", 1)
+	c.handlersMu.RLock()
+	_, running := c.workers["/foo"]
+	c.handlersMu.RUnlock()
+	if running {
+		t.Errorf("Expected the worker to stop with the channel's last handler")
+	}
+}
@@ -2,4 +2,6 @@ module github.com/charlinchui/galliard-client
 
 go 1.23.8
 
-require github.com/charlinchui/galliard v0.0.1-alpha // indirect
+require github.com/charlinchui/galliard v0.0.1-alpha
+
+require golang.org/x/time v0.8.0